@@ -0,0 +1,154 @@
+package compiler
+
+import (
+	"fmt"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/paths"
+)
+
+// valueType ... type of value of expression
+type valueType int
+
+const (
+	typeNumber valueType = iota
+	// typePoint ... relative position from the caster. it is x and y on stack
+	typePoint
+	// typeString ... index of string in constant pool of program
+	typeString
+)
+
+func (t valueType) String() string {
+	switch t {
+	case typePoint:
+		return "point"
+	case typeString:
+		return "string"
+	default:
+		return "number"
+	}
+}
+
+// width ... number of stack values of the type
+func (t valueType) width() int {
+	if t == typePoint {
+		return 2
+	}
+	return 1
+}
+
+// builtin ... function which queries game at cast time
+type builtin struct {
+	params []valueType
+	result valueType
+	// call ... args and results are stack values in push order
+	call func(args []int64, strings []string, w World) (results []int64, err error)
+}
+
+// builtins ... key is name of function
+var builtins = map[string]builtin{
+	"nearest-enemy": {
+		result: typePoint,
+		call:   nearestEnemy,
+	},
+	"player-x": {
+		result: typeNumber,
+		call: func(args []int64, strings []string, w World) (results []int64, err error) {
+			p := w.PlayerPosition().Sub(w.CasterPosition())
+			results = []int64{int64(p.X)}
+			return
+		},
+	},
+	"player-y": {
+		result: typeNumber,
+		call: func(args []int64, strings []string, w World) (results []int64, err error) {
+			p := w.PlayerPosition().Sub(w.CasterPosition())
+			results = []int64{int64(p.Y)}
+			return
+		},
+	},
+	"nearest-named": {
+		params: []valueType{typeString},
+		result: typePoint,
+		call:   nearestNamed,
+	},
+	"enemy-count-in": {
+		params: []valueType{typeNumber},
+		result: typeNumber,
+		call:   enemyCountIn,
+	},
+}
+
+// argWidth ... number of stack values which builtin pops
+func (b builtin) argWidth() (width int) {
+	for _, p := range b.params {
+		width += p.width()
+	}
+	return
+}
+
+// nearestEnemy ... relative position of the nearest hostile in sight
+func nearestEnemy(args []int64, strings []string, w World) (results []int64, err error) {
+	results, err = nearest(w.CasterPosition(), w.Hostiles(), "enemy")
+	return
+}
+
+// nearestNamed ... relative position of the nearest entity in sight named strings[args[0]]
+func nearestNamed(args []int64, strings []string, w World) (results []int64, err error) {
+	if args[0] < 0 || args[0] >= int64(len(strings)) {
+		err = fmt.Errorf("internal error: string %d out of range", args[0])
+		return
+	}
+	name := strings[args[0]]
+	results, err = nearest(w.CasterPosition(), w.Named(name), name)
+	return
+}
+
+// nearest ... relative position of the nearest of points from caster. ties are broken by y then x.
+// what is used for error message
+func nearest(caster gruid.Point, points []gruid.Point, what string) (results []int64, err error) {
+	found := false
+	var closest gruid.Point
+	for _, p := range points {
+		if !found || closer(caster, p, closest) {
+			closest = p
+			found = true
+		}
+	}
+	if !found {
+		err = fmt.Errorf("runtime error: no %s in sight", what)
+		return
+	}
+	p := closest.Sub(caster)
+	results = []int64{int64(p.X), int64(p.Y)}
+	return
+}
+
+// closer ... p is closer to origin than q
+func closer(origin, p, q gruid.Point) bool {
+	dp, dq := paths.DistanceManhattan(origin, p), paths.DistanceManhattan(origin, q)
+	if dp != dq {
+		return dp < dq
+	}
+	if p.Y != q.Y {
+		return p.Y < q.Y
+	}
+	return p.X < q.X
+}
+
+// enemyCountIn ... number of hostiles in sight within distance args[0] of the caster
+func enemyCountIn(args []int64, strings []string, w World) (results []int64, err error) {
+	if args[0] < 0 {
+		err = fmt.Errorf("runtime error: negative distance %d", args[0])
+		return
+	}
+	caster := w.CasterPosition()
+	count := int64(0)
+	for _, p := range w.Hostiles() {
+		if int64(paths.DistanceManhattan(caster, p)) <= args[0] {
+			count++
+		}
+	}
+	results = []int64{count}
+	return
+}
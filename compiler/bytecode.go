@@ -0,0 +1,235 @@
+package compiler
+
+import (
+	"bytes"
+	"domain"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+type OpCode byte
+
+const (
+	// OpHalt ... stop the program
+	OpHalt OpCode = iota
+	// OpPush ... push Arg
+	OpPush
+	// OpLoad ... push value of variable slot Arg
+	OpLoad
+	// OpStore ... pop a value and store it to variable slot Arg
+	OpStore
+	// OpAdd ... pop b, a and push a + b
+	OpAdd
+	// OpSub ... pop b, a and push a - b
+	OpSub
+	// OpMul ... pop b, a and push a * b
+	OpMul
+	// OpDiv ... pop b, a and push a / b
+	OpDiv
+	// OpNeg ... pop a and push -a
+	OpNeg
+	// OpJump ... jump to instruction Arg
+	OpJump
+	// OpJumpIfZero ... pop a value and jump to instruction Arg if it is 0
+	OpJumpIfZero
+	// OpMagic ... pop operands and emit magic of operator named Strings[Arg]
+	OpMagic
+	// OpCall ... pop arguments and push results of builtin named Strings[Arg]
+	OpCall
+	// OpLess ... pop b, a and push 1 if a < b, otherwise 0
+	OpLess
+	// OpLessEqual ... pop b, a and push 1 if a <= b, otherwise 0
+	OpLessEqual
+	// OpGreater ... pop b, a and push 1 if a > b, otherwise 0
+	OpGreater
+	// OpGreaterEqual ... pop b, a and push 1 if a >= b, otherwise 0
+	OpGreaterEqual
+	// OpEqual ... pop b, a and push 1 if a == b, otherwise 0
+	OpEqual
+	// OpString ... push Arg which is index of string in Strings
+	OpString
+	// OpShape ... magics emitted after this have shape Arg
+	OpShape
+	// OpElement ... magics emitted after this have element Arg
+	OpElement
+	// OpBeginTiming ... pop turns and add them to delay or duration of magics emitted after this. Arg is timing
+	OpBeginTiming
+	// OpEndTiming ... remove turns added by the last OpBeginTiming of timing Arg
+	OpEndTiming
+	// OpBeginRepeat ... pop times and begin loop of repeat
+	OpBeginRepeat
+	// OpRepeat ... begin next iteration of the last loop, or end the loop and jump to instruction Arg after the last iteration
+	OpRepeat
+	opEnd // number of op codes
+)
+
+const (
+	// timingDelay ... Arg of timing ops which delays magics
+	timingDelay int64 = iota
+	// timingPersist ... Arg of timing ops which makes magics persist
+	timingPersist
+	timingEnd
+)
+
+// timingWords ... source word of each timing
+var timingWords = [timingEnd]string{timingDelay: "delay", timingPersist: "persist"}
+
+type Instruction struct {
+	Op  OpCode
+	Arg int64
+}
+
+// Program ... compiled spell which vm executes
+type Program struct {
+	Code []Instruction
+	// Strings ... constant pool. magic is referred by its name so that saved programs do not depend on order of spells
+	Strings []string
+	// Slots ... number of variable slots
+	Slots int
+}
+
+// header of serialized program and its version
+var programMagic = []byte("RTSP")
+
+const programVersion = 1
+
+// MarshalBinary ... serialize program. it also makes Program encodable by gob
+func (p *Program) MarshalBinary() (data []byte, err error) {
+	buf := &bytes.Buffer{}
+	buf.Write(programMagic)
+	buf.WriteByte(programVersion)
+	buf.Write(binary.AppendUvarint(nil, uint64(p.Slots)))
+
+	buf.Write(binary.AppendUvarint(nil, uint64(len(p.Strings))))
+	for _, s := range p.Strings {
+		buf.Write(binary.AppendUvarint(nil, uint64(len(s))))
+		buf.WriteString(s)
+	}
+
+	buf.Write(binary.AppendUvarint(nil, uint64(len(p.Code))))
+	for _, inst := range p.Code {
+		buf.WriteByte(byte(inst.Op))
+		buf.Write(binary.AppendVarint(nil, inst.Arg))
+	}
+	data = buf.Bytes()
+	return
+}
+
+// UnmarshalBinary ... deserialize program made by MarshalBinary and verify it
+func (p *Program) UnmarshalBinary(data []byte) (err error) {
+	r := bytes.NewReader(data)
+	header := make([]byte, len(programMagic)+1)
+	if _, err = io.ReadFull(r, header); err != nil || !bytes.Equal(header[:len(programMagic)], programMagic) {
+		err = errors.New("invalid program: wrong header")
+		return
+	}
+	if header[len(programMagic)] != programVersion {
+		err = fmt.Errorf("invalid program: unknown version %d", header[len(programMagic)])
+		return
+	}
+
+	decoded := Program{}
+	slots, err := binary.ReadUvarint(r)
+	if err != nil {
+		err = fmt.Errorf("invalid program: %w", err)
+		return
+	}
+	decoded.Slots = int(slots)
+
+	n, err := binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		err = errors.New("invalid program: broken strings")
+		return
+	}
+	for i := uint64(0); i < n; i++ {
+		var length uint64
+		length, err = binary.ReadUvarint(r)
+		if err != nil || length > uint64(r.Len()) {
+			err = errors.New("invalid program: broken strings")
+			return
+		}
+		s := make([]byte, length)
+		if _, err = io.ReadFull(r, s); err != nil {
+			return
+		}
+		decoded.Strings = append(decoded.Strings, string(s))
+	}
+
+	n, err = binary.ReadUvarint(r)
+	if err != nil || n > uint64(r.Len()) {
+		err = errors.New("invalid program: broken code")
+		return
+	}
+	for i := uint64(0); i < n; i++ {
+		var op byte
+		op, err = r.ReadByte()
+		if err != nil {
+			err = errors.New("invalid program: broken code")
+			return
+		}
+		var arg int64
+		arg, err = binary.ReadVarint(r)
+		if err != nil {
+			err = errors.New("invalid program: broken code")
+			return
+		}
+		decoded.Code = append(decoded.Code, Instruction{Op: OpCode(op), Arg: arg})
+	}
+
+	if err = decoded.verify(); err != nil {
+		return
+	}
+	*p = decoded
+	return
+}
+
+// verify ... check operands of instructions refer inside of program
+func (p *Program) verify() (err error) {
+	// every slot is written by OpStore, so a program never needs more slots than instructions
+	if p.Slots < 0 || p.Slots > len(p.Code) {
+		err = fmt.Errorf("invalid program: %d slots for %d instructions", p.Slots, len(p.Code))
+		return
+	}
+	for i, inst := range p.Code {
+		switch inst.Op {
+		case OpLoad, OpStore:
+			if inst.Arg < 0 || inst.Arg >= int64(p.Slots) {
+				err = fmt.Errorf("invalid program: slot %d out of range at %d", inst.Arg, i)
+				return
+			}
+		case OpJump, OpJumpIfZero, OpRepeat:
+			if inst.Arg < 0 || inst.Arg > int64(len(p.Code)) {
+				err = fmt.Errorf("invalid program: jump to %d out of range at %d", inst.Arg, i)
+				return
+			}
+		case OpShape:
+			if !domain.MagicShape(inst.Arg).Valid() {
+				err = fmt.Errorf("invalid program: unknown shape %d at %d", inst.Arg, i)
+				return
+			}
+		case OpBeginTiming, OpEndTiming:
+			if inst.Arg < 0 || inst.Arg >= timingEnd {
+				err = fmt.Errorf("invalid program: unknown timing %d at %d", inst.Arg, i)
+				return
+			}
+		case OpElement:
+			if !domain.Element(inst.Arg).Valid() {
+				err = fmt.Errorf("invalid program: unknown element %d at %d", inst.Arg, i)
+				return
+			}
+		case OpMagic, OpCall, OpString:
+			if inst.Arg < 0 || inst.Arg >= int64(len(p.Strings)) {
+				err = fmt.Errorf("invalid program: string %d out of range at %d", inst.Arg, i)
+				return
+			}
+		default:
+			if inst.Op >= opEnd {
+				err = fmt.Errorf("invalid program: unknown op code %d at %d", inst.Op, i)
+				return
+			}
+		}
+	}
+	return
+}
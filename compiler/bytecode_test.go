@@ -0,0 +1,66 @@
+package compiler
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProgramBinary(t *testing.T) {
+	program, err := Build("(let ((d 2)) (seiethr (* d 3) (- d)))")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := program.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded := &Program{}
+	err = decoded.UnmarshalBinary(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, program, decoded)
+
+	// gob uses MarshalBinary so that programs can be stored in saves
+	buf := &bytes.Buffer{}
+	err = gob.NewEncoder(buf).Encode(program)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gobDecoded := &Program{}
+	err = gob.NewDecoder(buf).Decode(gobDecoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, program, gobDecoded)
+
+	// broken data is rejected
+	for key, broken := range map[string][]byte{
+		"empty": {},
+		"truncated": data[:len(data)-1],
+		"wrong header": append([]byte("XXXX"), data[4:]...),
+	} {
+		assert.NotNil(t, (&Program{}).UnmarshalBinary(broken), key)
+	}
+
+	// program refers outside of it
+	for key, invalid := range map[string]*Program{
+		"slot": {Code: []Instruction{{Op: OpLoad, Arg: 3}}},
+		"negative slots": {Code: []Instruction{{Op: OpHalt}}, Slots: -1},
+		"too many slots": {Code: []Instruction{{Op: OpHalt}}, Slots: 1 << 40},
+		"shape": {Code: []Instruction{{Op: OpShape, Arg: 9}}},
+		"element": {Code: []Instruction{{Op: OpElement, Arg: -1}}},
+		"timing": {Code: []Instruction{{Op: OpBeginTiming, Arg: 2}}},
+		"repeat": {Code: []Instruction{{Op: OpRepeat, Arg: 5}}},
+	} {
+		data, err = invalid.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.NotNil(t, (&Program{}).UnmarshalBinary(data), key)
+	}
+}
@@ -0,0 +1,619 @@
+package compiler
+
+import (
+	"domain"
+	"fmt"
+	"math"
+	"strconv"
+	"unicode/utf8"
+)
+
+// Severity ... how bad a diagnostic is
+type Severity int
+
+const (
+	// SeverityWarning ... spell can be cast but it may not work as the caster thinks
+	SeverityWarning Severity = iota
+	// SeverityError ... spell can not be compiled
+	SeverityError
+)
+
+func (s Severity) String() string {
+	if s == SeverityError {
+		return "error"
+	}
+	return "warning"
+}
+
+// Diagnostic ... problem found by static check of spell
+type Diagnostic struct {
+	Pos      domain.Position
+	Severity Severity
+	Message  string
+	// width ... number of runes of the source which the diagnostic points
+	width int
+}
+
+func (d *Diagnostic) Error() string {
+	return fmt.Sprintf("column %d: %s: %s", d.Pos.Column+1, d.Severity, d.Message)
+}
+
+// Position ... where the diagnostic points in source
+func (d *Diagnostic) Position() domain.Position {
+	return d.Pos
+}
+
+// Width ... number of runes of the source which the diagnostic points
+func (d *Diagnostic) Width() int {
+	if d.width <= 0 {
+		return 1
+	}
+	return d.width
+}
+
+// Check ... check spell source without casting it. err is the first error which stops compiling
+// and warnings are problems of spell which can be cast
+func Check(arg string) (warnings []*Diagnostic, err error) {
+	tokens, err := lexicalAnalyze(arg)
+	if err != nil {
+		return
+	}
+	ast, err := parse(tokens)
+	if err != nil {
+		return
+	}
+	warnings, err = check(ast)
+	return
+}
+
+// Cost ... mana which spell costs computed without casting it. when if or persist depends on game,
+// it is the most mana which the spell can cost
+func Cost(arg string) (cost int, err error) {
+	tokens, err := lexicalAnalyze(arg)
+	if err != nil {
+		return
+	}
+	ast, err := parse(tokens)
+	if err != nil {
+		return
+	}
+	_, cost, err = analyze(ast)
+	return
+}
+
+// check ... semantic analysis of ast made by parser
+func check(ast *domain.Node) (warnings []*Diagnostic, err error) {
+	warnings, _, err = analyze(ast)
+	return
+}
+
+// analyze ... check ast and compute its mana cost
+func analyze(ast *domain.Node) (warnings []*Diagnostic, cost int, err error) {
+	c := &checker{repeat: 1}
+	c.checkRoot(ast)
+	for _, d := range c.diagnostics {
+		if d.Severity == SeverityError {
+			err = d
+			return
+		}
+	}
+	warnings = c.diagnostics
+	cost = int(c.cost)
+	return
+}
+
+// checkValue ... type of expression and its value if it is known before casting
+type checkValue struct {
+	typ   valueType
+	known bool
+	// x ... value of number or x of point
+	x int64
+	y int64
+}
+
+// checkScope ... names bound by let while checking
+type checkScope struct {
+	values map[string]checkValue
+	outer  *checkScope
+}
+
+func (s *checkScope) lookup(name string) (v checkValue, ok bool) {
+	for e := s; e != nil; e = e.outer {
+		if v, ok = e.values[name]; ok {
+			return
+		}
+	}
+	return
+}
+
+type checker struct {
+	diagnostics []*Diagnostic
+	// shape ... shape of magics checked now
+	shape domain.MagicShape
+	// cost ... mana of magics checked so far
+	cost int64
+	// persist ... turns which magics checked now persist. mana is spent for each turn
+	persist int64
+	// repeat ... mana of magics checked now is multiplied by it. it is total of iterations of each repeat
+	repeat int64
+}
+
+func (c *checker) report(node *domain.Node, severity Severity, format string, a ...interface{}) {
+	c.diagnostics = append(c.diagnostics, &Diagnostic{
+		Pos:      node.Pos,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, a...),
+		width:    nodeWidth(node),
+	})
+}
+
+func (c *checker) checkRoot(ast *domain.Node) {
+	if ast == nil || ast.Left == nil {
+		return
+	}
+	scope := &checkScope{}
+	if ast.Left.Data.Label == domain.OperatorDefine {
+		if ast.Right == nil || ast.Right.Left == nil || ast.Right.Left.Type != domain.Expression {
+			c.report(ast.Left, SeverityError, "define expects a spell")
+			return
+		}
+		c.checkSubForm(ast.Right.Left, scope)
+		return
+	}
+	c.checkForm(ast.Left, ast.Right, scope)
+}
+
+// checkForm ... check a form which emits magics
+func (c *checker) checkForm(operator, operands *domain.Node, scope *checkScope) {
+	switch operator.Data.Label {
+	case domain.OperatorLet:
+		inner, body, ok := c.checkLet(operator, operands, scope)
+		if ok {
+			c.checkSubForm(body, inner)
+		}
+	case domain.OperatorSeq:
+		nodes, ok := c.operands(operator, operands)
+		if !ok {
+			return
+		}
+		if len(nodes) < 1 {
+			c.report(operator, SeverityError, "seq expects at least 1 form")
+			return
+		}
+		for _, node := range nodes {
+			c.checkSubForm(node, scope)
+		}
+	case domain.OperatorIf:
+		// cost of form is the cost of reachable branch, or the more one if both are reachable
+		before := c.cost
+		costs := []int64{}
+		v := c.checkIf(operator, operands, scope, func(node *domain.Node) (v checkValue) {
+			c.cost = 0
+			c.checkSubForm(node, scope)
+			costs = append(costs, c.cost)
+			v = checkValue{known: true, x: c.cost}
+			return
+		})
+		c.cost = before
+		switch {
+		case v.known:
+			c.cost += v.x
+		case len(costs) == 2:
+			c.cost += max(costs[0], costs[1])
+		}
+	case domain.OperatorSpell:
+		c.checkMagic(operator, operands, scope)
+	case domain.OperatorShape, domain.OperatorElement:
+		nodes, ok := c.operands(operator, operands)
+		if !ok {
+			return
+		}
+		if len(nodes) != 1 {
+			c.report(operator, SeverityError, "%s expects 1 form but got %d", operator.Data.Text, len(nodes))
+			return
+		}
+		if operator.Data.Label == domain.OperatorElement {
+			c.checkSubForm(nodes[0], scope)
+			return
+		}
+		outer := c.shape
+		c.shape = shapes[operator.Data.Text]
+		c.checkSubForm(nodes[0], scope)
+		c.shape = outer
+	case domain.OperatorDelay, domain.OperatorPersist:
+		nodes, ok := c.operands(operator, operands)
+		if !ok {
+			return
+		}
+		if len(nodes) != 2 {
+			c.report(operator, SeverityError, "%s expects turns and form", operatorWord(operator))
+			return
+		}
+		turns := c.checkNumber(nodes[0], scope)
+		if turns.known && (turns.x < 0 || turns.x > domain.MaxSpellTurns) {
+			c.report(nodes[0], SeverityError, "turns must be 0 to %d but got %d", domain.MaxSpellTurns, turns.x)
+			return
+		}
+		if operator.Data.Label == domain.OperatorDelay {
+			c.checkSubForm(nodes[1], scope)
+			return
+		}
+		// turns decided at cast time are counted as many as possible
+		outer := c.persist
+		if turns.known {
+			c.persist = min(c.persist+turns.x, domain.MaxSpellTurns)
+		} else {
+			c.persist = domain.MaxSpellTurns
+		}
+		c.checkSubForm(nodes[1], scope)
+		c.persist = outer
+	case domain.OperatorRepeat:
+		nodes, ok := c.operands(operator, operands)
+		if !ok {
+			return
+		}
+		if len(nodes) != 2 {
+			c.report(operator, SeverityError, "repeat expects times and form")
+			return
+		}
+		// times must be known to compute cost before casting
+		times := c.checkNumber(nodes[0], scope)
+		if !times.known {
+			c.report(nodes[0], SeverityError, "times of repeat must be known before casting")
+			return
+		}
+		if times.x < 1 || times.x > domain.MaxRepeat {
+			c.report(nodes[0], SeverityError, "repeat must be 1 to %d times but got %d", domain.MaxRepeat, times.x)
+			return
+		}
+		// k-th iteration costs k times, so iterations cost 1 + 2 + ... + times
+		outer := c.repeat
+		c.repeat *= times.x * (times.x + 1) / 2
+		c.checkSubForm(nodes[1], scope)
+		c.repeat = outer
+	case domain.OperatorDefine:
+		c.report(operator, SeverityError, "define must be the whole spell")
+	default:
+		c.report(operator, SeverityError, "%s is not a magic", operatorWord(operator))
+	}
+}
+
+func (c *checker) checkSubForm(node *domain.Node, scope *checkScope) {
+	if node.Type != domain.Expression || node.Left == nil {
+		c.report(node, SeverityError, "expected form of magic")
+		return
+	}
+	c.checkForm(node.Left, node.Right, scope)
+}
+
+// checkLet ... check bindings of let. returns scope of them and body
+func (c *checker) checkLet(operator, operands *domain.Node, scope *checkScope) (inner *checkScope, body *domain.Node, ok bool) {
+	nodes, ok := c.operands(operator, operands)
+	if !ok || len(nodes) != 2 {
+		ok = false
+		return
+	}
+	bindings, ok := c.operands(operator, nodes[0])
+	if !ok {
+		return
+	}
+	inner = &checkScope{values: map[string]checkValue{}, outer: scope}
+	for _, binding := range bindings {
+		if binding.Left == nil {
+			ok = false
+			return
+		}
+		inner.values[binding.Data.Text] = c.checkExpression(binding.Left, inner)
+	}
+	body = nodes[1]
+	return
+}
+
+// checkIf ... check condition and branches of if. checkBranch checks each branch
+func (c *checker) checkIf(operator, conditional *domain.Node, scope *checkScope, checkBranch func(node *domain.Node) checkValue) (v checkValue) {
+	if conditional == nil || conditional.Type != domain.Conditional || conditional.Right == nil {
+		c.report(operator, SeverityError, "if expects condition, then and else")
+		return
+	}
+	cond := c.checkNumber(conditional.Left, scope)
+	dead := -1
+	if cond.known {
+		dead = 0
+		if cond.x != 0 {
+			dead = 1
+		}
+	}
+	branches := [2]checkValue{}
+	for i, node := range []*domain.Node{conditional.Right.Left, conditional.Right.Right} {
+		reported := len(c.diagnostics)
+		branches[i] = checkBranch(node)
+		// dead branch is never run. only its type is needed
+		if i == dead {
+			c.diagnostics = c.diagnostics[:reported]
+		}
+	}
+	then, otherwise := branches[0], branches[1]
+	if then.typ != otherwise.typ {
+		c.report(operator, SeverityError, "branches of if are %s and %s", then.typ, otherwise.typ)
+		return
+	}
+	v.typ = then.typ
+	if !cond.known {
+		return
+	}
+	if cond.x != 0 {
+		c.report(conditional.Right.Right, SeverityWarning, "else branch is unreachable")
+		v = then
+	} else {
+		c.report(conditional.Right.Left, SeverityWarning, "then branch is unreachable")
+		v = otherwise
+	}
+	return
+}
+
+// checkMagic ... check operands of magic operator and where the magic hits
+func (c *checker) checkMagic(operator, operands *domain.Node, scope *checkScope) {
+	op, ok := operators[operator.Data.Text]
+	if !ok {
+		c.report(operator, SeverityError, "unknown magic %s", operator.Data.Text)
+		return
+	}
+	nodes, ok := c.operands(operator, operands)
+	if !ok {
+		return
+	}
+	values := []checkValue{}
+	types := []valueType{}
+	for _, node := range nodes {
+		v := c.checkExpression(node, scope)
+		// name of entity is resolved at cast time
+		if v.typ == typeString {
+			v = checkValue{typ: typePoint}
+		}
+		values = append(values, v)
+		types = append(types, v.typ)
+	}
+	if !op.matchParams(types) {
+		c.report(operator, SeverityError, "%s expects %s but got %s", op.Name, op.usage(), typeList(types))
+		return
+	}
+	c.cost += int64(op.Amount) * (c.persist + 1) * c.repeat
+
+	// collect target in order of parameters
+	var target checkValue
+	for _, p := range op.Params {
+		switch p {
+		case paramTarget:
+			if values[0].typ == typePoint {
+				target = values[0]
+				values = values[1:]
+				continue
+			}
+			target = checkValue{typ: typePoint, known: values[0].known && values[1].known, x: values[0].x, y: values[1].x}
+			values = values[2:]
+		}
+	}
+	if !target.known {
+		return
+	}
+	if !inSight(target.x, target.y) {
+		c.report(operator, SeverityError, "target (%d, %d) of %s is out of sight", target.x, target.y, op.Name)
+	}
+	if effects[op.Effect] == domain.EffectDamage && hitsOrigin(c.shape, target.x, target.y, int64(op.Radius)) {
+		c.report(operator, SeverityWarning, "%s hits the caster", op.Name)
+	}
+}
+
+// hitsOrigin ... area of shape around target (x, y) with radius contains caster at (0, 0).
+// line and cone start next to the caster
+func hitsOrigin(shape domain.MagicShape, x, y, radius int64) bool {
+	switch shape {
+	case domain.ShapeLine, domain.ShapeCone:
+		return false
+	case domain.ShapeCross:
+		if x != 0 && y != 0 {
+			return false
+		}
+	}
+	return x*x+y*y <= radius*radius
+}
+
+// checkExpression ... check expression and infer its type
+func (c *checker) checkExpression(node *domain.Node, scope *checkScope) (v checkValue) {
+	switch node.Type {
+	case domain.Literal:
+		switch node.Data.Label {
+		case domain.Number:
+			v = checkValue{typ: typeNumber, known: true, x: node.Data.Number}
+		case domain.String:
+			v = checkValue{typ: typeString}
+		default:
+			c.report(node, SeverityError, "unexpected literal")
+		}
+	case domain.Variable:
+		var ok bool
+		if v, ok = scope.lookup(node.Data.Text); !ok {
+			c.report(node, SeverityError, "%s is not defined", node.Data.Text)
+		}
+	case domain.Expression:
+		v = c.checkOperation(node.Left, node.Right, scope)
+	default:
+		c.report(node, SeverityError, "unexpected operand")
+	}
+	return
+}
+
+// checkOperation ... check expression (operator operands...) which makes a value
+func (c *checker) checkOperation(operator, operands *domain.Node, scope *checkScope) (v checkValue) {
+	v.typ = typeNumber
+	switch operator.Data.Label {
+	case domain.OperatorLet:
+		inner, body, ok := c.checkLet(operator, operands, scope)
+		if ok {
+			v = c.checkExpression(body, inner)
+		}
+	case domain.OperatorIf:
+		v = c.checkIf(operator, operands, scope, func(node *domain.Node) checkValue {
+			return c.checkExpression(node, scope)
+		})
+	case domain.OperatorBuiltin:
+		v = c.checkBuiltin(operator, operands, scope)
+	case domain.OperatorAdd, domain.OperatorSub, domain.OperatorMul, domain.OperatorDiv:
+		v = c.checkArithmetic(operator, operands, scope)
+	case domain.OperatorLess, domain.OperatorLessEqual, domain.OperatorGreater, domain.OperatorGreaterEqual, domain.OperatorEqual:
+		v = c.checkComparison(operator, operands, scope)
+	default:
+		c.report(operator, SeverityError, "%s does not make a value", operatorWord(operator))
+	}
+	return
+}
+
+func (c *checker) checkBuiltin(operator, operands *domain.Node, scope *checkScope) (v checkValue) {
+	b, ok := builtins[operator.Data.Text]
+	if !ok {
+		c.report(operator, SeverityError, "unknown function %s", operator.Data.Text)
+		return
+	}
+	v.typ = b.result
+	nodes, ok := c.operands(operator, operands)
+	if !ok {
+		return
+	}
+	types := []valueType{}
+	for _, node := range nodes {
+		types = append(types, c.checkExpression(node, scope).typ)
+	}
+	if !sameTypes(types, b.params) {
+		c.report(operator, SeverityError, "%s expects %s but got %s", operator.Data.Text, typeList(b.params), typeList(types))
+	}
+	return
+}
+
+// checkArithmetic ... check operands are numbers and fold them if they are known
+func (c *checker) checkArithmetic(operator, operands *domain.Node, scope *checkScope) (v checkValue) {
+	v.typ = typeNumber
+	nodes, ok := c.operands(operator, operands)
+	if !ok {
+		return
+	}
+	op := map[domain.DataLabel]OpCode{
+		domain.OperatorAdd: OpAdd,
+		domain.OperatorSub: OpSub,
+		domain.OperatorMul: OpMul,
+		domain.OperatorDiv: OpDiv,
+	}[operator.Data.Label]
+	if len(nodes) < 1 || (op == OpDiv && len(nodes) < 2) {
+		c.report(operator, SeverityError, "%s expects more operands", operatorWord(operator))
+		return
+	}
+
+	values := []checkValue{}
+	for _, node := range nodes {
+		values = append(values, c.checkNumber(node, scope))
+	}
+	v = values[0]
+	if op == OpSub && len(values) == 1 {
+		if v.known && v.x == math.MinInt64 {
+			c.report(nodes[0], SeverityError, "integer overflow")
+			v.known = false
+		}
+		v.x = -v.x
+		return
+	}
+	for i, w := range values[1:] {
+		if op == OpDiv && w.known && w.x == 0 {
+			c.report(nodes[i+1], SeverityError, "division by zero")
+			v.known = false
+			return
+		}
+		v.known = v.known && w.known
+		if v.known {
+			var err error
+			if v.x, err = arithmetic(op, v.x, w.x); err != nil {
+				c.report(nodes[i+1], SeverityError, "integer overflow")
+				v.known = false
+				return
+			}
+		}
+	}
+	return
+}
+
+func (c *checker) checkComparison(operator, operands *domain.Node, scope *checkScope) (v checkValue) {
+	v.typ = typeNumber
+	nodes, ok := c.operands(operator, operands)
+	if !ok {
+		return
+	}
+	if len(nodes) != 2 {
+		c.report(operator, SeverityError, "%s expects 2 operands but got %d", operatorWord(operator), len(nodes))
+		return
+	}
+	a, b := c.checkNumber(nodes[0], scope), c.checkNumber(nodes[1], scope)
+	if !a.known || !b.known {
+		return
+	}
+	op := map[domain.DataLabel]OpCode{
+		domain.OperatorLess:         OpLess,
+		domain.OperatorLessEqual:    OpLessEqual,
+		domain.OperatorGreater:      OpGreater,
+		domain.OperatorGreaterEqual: OpGreaterEqual,
+		domain.OperatorEqual:        OpEqual,
+	}[operator.Data.Label]
+	v.known = true
+	v.x, _ = arithmetic(op, a.x, b.x)
+	return
+}
+
+// checkNumber ... check expression which must be number
+func (c *checker) checkNumber(node *domain.Node, scope *checkScope) (v checkValue) {
+	v = c.checkExpression(node, scope)
+	if v.typ != typeNumber {
+		c.report(node, SeverityError, "expected number but got %s", v.typ)
+		v = checkValue{typ: typeNumber}
+	}
+	return
+}
+
+// operands ... operand nodes of operator. malformed list is reported
+func (c *checker) operands(operator, operands *domain.Node) (nodes []*domain.Node, ok bool) {
+	nodes, err := getOperands(operands)
+	if err != nil {
+		c.report(operator, SeverityError, "%s has broken operands", operatorWord(operator))
+		return
+	}
+	ok = true
+	return
+}
+
+// operatorWord ... source word of operator
+func operatorWord(operator *domain.Node) (word string) {
+	switch operator.Data.Label {
+	case domain.OperatorSpell, domain.OperatorBuiltin, domain.OperatorShape, domain.OperatorElement:
+		word = operator.Data.Text
+		return
+	}
+	word = operatorWords[operator.Data.Label]
+	return
+}
+
+// nodeWidth ... number of runes of the token which node is made from
+func nodeWidth(node *domain.Node) (width int) {
+	switch node.Type {
+	case domain.Operator:
+		width = utf8.RuneCountInString(operatorWord(node))
+	case domain.Expression:
+		if node.Left != nil {
+			width = utf8.RuneCountInString(operatorWord(node.Left))
+		}
+	case domain.Literal:
+		if node.Data.Label == domain.String {
+			width = utf8.RuneCountInString(quote(node.Data.Text))
+		} else {
+			width = len(strconv.FormatInt(node.Data.Number, 10))
+		}
+	case domain.Variable, domain.Binding:
+		width = utf8.RuneCountInString(node.Data.Text)
+	}
+	return
+}
@@ -0,0 +1,214 @@
+package compiler
+
+import (
+	"domain"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheck(t *testing.T) {
+	type TestItem struct {
+		Arg string
+		IsSuccess bool
+		// ExpectedWarnings ... messages of warnings in order
+		ExpectedWarnings []string
+		// ExpectedColumn ... column of error if check fails
+		ExpectedColumn int
+	}
+	table := map[string]TestItem{
+		"clean spell": {
+			Arg: "(gandr 1 2)",
+			IsSuccess: true,
+		},
+		"out of sight": {
+			Arg: "(gandr 8 (+ 2 1))",
+			IsSuccess: false,
+			ExpectedColumn: 1,
+		},
+		"target through let": {
+			Arg: "(let ((x 11)) (gandr x 0))",
+			IsSuccess: false,
+			ExpectedColumn: 15,
+		},
+		"self damage": {
+			Arg: "(gandr 0 0)",
+			IsSuccess: true,
+			ExpectedWarnings: []string{"gandr hits the caster"},
+		},
+		"self damage by radius": {
+			Arg: "(seiethr 1 2)",
+			IsSuccess: true,
+			ExpectedWarnings: []string{"seiethr hits the caster"},
+		},
+		"line starts next to caster": {
+			Arg: "(line (seiethr 1 0))",
+			IsSuccess: true,
+		},
+		"cross misses caster": {
+			Arg: "(cross (seiethr 1 1))",
+			IsSuccess: true,
+		},
+		"cross hits caster": {
+			Arg: "(cross (seiethr 0 2))",
+			IsSuccess: true,
+			ExpectedWarnings: []string{"seiethr hits the caster"},
+		},
+		"delay turns": {
+			Arg: "(delay 11 (gandr 1 0))",
+			IsSuccess: false,
+			ExpectedColumn: 7,
+		},
+		"persist on caster": {
+			Arg: "(persist 2 (seiethr 1 0))",
+			IsSuccess: true,
+			ExpectedWarnings: []string{"seiethr hits the caster"},
+		},
+		"repeat times": {
+			Arg: "(repeat (+ 3 3) (gandr 1 0))",
+			IsSuccess: false,
+			ExpectedColumn: 9,
+		},
+		"repeat times unknown": {
+			Arg: "(repeat (player-x) (gandr 1 0))",
+			IsSuccess: false,
+			ExpectedColumn: 9,
+		},
+		"unknown target": {
+			Arg: "(gandr (nearest-enemy))",
+			IsSuccess: true,
+		},
+		"unreachable else": {
+			Arg: "(if (< 1 2) (gandr 1 0) (gandr 2 0))",
+			IsSuccess: true,
+			ExpectedWarnings: []string{"else branch is unreachable"},
+		},
+		"dead branch out of sight": {
+			Arg: "(if 1 (gandr 1 0) (gandr 50 0))",
+			IsSuccess: true,
+			ExpectedWarnings: []string{"else branch is unreachable"},
+		},
+		"dead branch hits caster": {
+			Arg: "(if 0 (gandr 0 0) (gandr 2 0))",
+			IsSuccess: true,
+			ExpectedWarnings: []string{"then branch is unreachable"},
+		},
+		"unreachable then": {
+			Arg: "(if 0 (gandr 1 0) (gandr 2 0))",
+			IsSuccess: true,
+			ExpectedWarnings: []string{"then branch is unreachable"},
+		},
+		"arity of magic": {
+			Arg: "(gandr 1)",
+			IsSuccess: false,
+			ExpectedColumn: 1,
+		},
+		"arity of comparison": {
+			Arg: "(gandr (if (< 1) 1 2) 0)",
+			IsSuccess: false,
+			ExpectedColumn: 12,
+		},
+		"arity of builtin": {
+			Arg: "(gandr (nearest-enemy 1))",
+			IsSuccess: false,
+			ExpectedColumn: 8,
+		},
+		"division by zero": {
+			Arg: "(gandr (/ 4 (- 2 2)) 0)",
+			IsSuccess: false,
+			ExpectedColumn: 13,
+		},
+		"types of branches": {
+			Arg: "(gandr (if 1 (nearest-enemy) 1) 0)",
+			IsSuccess: false,
+			ExpectedColumn: 8,
+		},
+	}
+
+	for key, item := range table {
+		warnings, err := Check(item.Arg)
+		if !item.IsSuccess {
+			d, ok := err.(*Diagnostic)
+			if !assert.True(t, ok, key) {
+				continue
+			}
+			assert.Equal(t, SeverityError, d.Severity, key)
+			assert.Equal(t, item.ExpectedColumn, d.Pos.Column, key)
+			continue
+		}
+		if err != nil {
+			t.Fatal(key, err)
+		}
+		messages := []string{}
+		for _, w := range warnings {
+			assert.Equal(t, SeverityWarning, w.Severity, key)
+			messages = append(messages, w.Message)
+		}
+		if item.ExpectedWarnings == nil {
+			item.ExpectedWarnings = []string{}
+		}
+		assert.Equal(t, item.ExpectedWarnings, messages, key)
+	}
+}
+
+func TestCost(t *testing.T) {
+	type TestItem struct {
+		Arg string
+		IsSuccess bool
+		ExpectedCost int
+	}
+	table := map[string]TestItem{
+		"magic": {"(gandr 1 2)", true, gandr.Amount},
+		"seq": {"(seq (gandr 1 2) (seiethr 3 0))", true, gandr.Amount + seiethr.Amount},
+		"persist": {"(persist 2 (gandr 1 2))", true, gandr.Amount * 3},
+		"persist decided at cast time": {"(persist (player-x) (gandr 1 2))", true, gandr.Amount * (domain.MaxSpellTurns + 1)},
+		"repeat": {"(repeat 3 (gandr 1 2))", true, gandr.Amount * 6},
+		"nested repeat": {"(repeat 2 (seq (gandr 1 0) (repeat 2 (persist 1 (gandr 2 0)))))", true, gandr.Amount * (1 + 2 + 2 + 4 + 4 + 8)},
+		"let bound repeat": {"(let ((n 2)) (repeat n (gandr 1 2)))", true, gandr.Amount * 3},
+		"reachable branch": {"(if (< 1 2) (gandr 1 0) (seiethr 2 0))", true, gandr.Amount},
+		"more branch": {"(if (player-x) (gandr 1 0) (seiethr 2 0))", true, seiethr.Amount},
+		"define": {"(define a (repeat 2 (gandr 1 0)))", true, gandr.Amount * 3},
+		"error": {"(repeat 9 (gandr 1 0))", false, 0},
+	}
+
+	for key, item := range table {
+		cost, err := Cost(item.Arg)
+		if !item.IsSuccess {
+			assert.NotNil(t, err, key)
+			continue
+		}
+		if err != nil {
+			t.Fatal(key, err)
+		}
+		assert.Equal(t, item.ExpectedCost, cost, key)
+	}
+
+	// static cost is the cost of compiled magics
+	for _, arg := range []string{"(repeat 3 (persist 2 (seq (gandr 1 0) (seiethr 2 0))))", "(repeat 2 (delay 1 (repeat 3 (gandr 1 0))))"} {
+		magics, err := Compile(arg)
+		if err != nil {
+			t.Fatal(arg, err)
+		}
+		total := 0
+		for _, magic := range magics {
+			total += magic.Amount
+		}
+		cost, err := Cost(arg)
+		assert.Nil(t, err, arg)
+		assert.Equal(t, total, cost, arg)
+	}
+}
+
+func TestBuildStopsAtCheckError(t *testing.T) {
+	_, err := Build("(gandr (/ 1 0) 0)")
+	d, ok := err.(*Diagnostic)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, "column 13: error: division by zero", d.Error())
+	assert.Equal(t, 1, d.Width())
+
+	// warnings do not stop building
+	_, err = Build("(gandr 0 0)")
+	assert.Nil(t, err)
+}
@@ -3,22 +3,37 @@ package compiler
 import (
 	"domain"
 	"fmt"
-
-	"github.com/anaseto/gruid"
 )
 
-const (
-	amountGandr = 5
-	amountSeiethr = 10 
-	radiusGandr = 0
-	radiusSeiethr = 3
-)
+// Compile ... compile spell source to magics which are cast in order. spell which queries game fails
+func Compile(arg string) (magics []domain.Magic, err error) {
+	magics, err = CompileWith(arg, nil)
+	return
+}
+
+// CompileWith ... compile spell source to magics cast by caster of w. queries of spell are resolved against w
+// and the caster has to know every keyword of the spell
+func CompileWith(arg string, w World) (magics []domain.Magic, err error) {
+	program, err := build(arg, w)
+	if err != nil {
+		return
+	}
 
+	magics, err = NewVM().Run(program, w)
+	return
+}
+
+// Build ... compile spell source to program of vm
+func Build(arg string) (program *Program, err error) {
+	program, err = build(arg, nil)
+	return
+}
 
-func Compile(arg string) (magic domain.Magic, err error) {
-	tokens, err := lexicalAnalyze(arg)
+// build ... compile spell source of a caster who knows words of v. every word is known if v is nil
+func build(arg string, v Vocabulary) (program *Program, err error) {
+	tokens, err := lexicalAnalyzeWith(arg, v)
 	if err != nil {
-		return 
+		return
 	}
 
 	ast, err := parse(tokens)
@@ -26,121 +41,602 @@ func Compile(arg string) (magic domain.Magic, err error) {
 		return
 	}
 
-	magic, err = genMagic(ast)
-	return 
+	// warnings do not stop compiling. caller gets them by Check
+	if _, err = check(ast); err != nil {
+		return
+	}
+
+	program, err = genProgram(ast)
+	return
 }
 
-func genMagic(ast *domain.Node) (magic domain.Magic, err error) {
-	if ast == nil {
-		return 
+// Lex ... split spell source into tokens
+func Lex(arg string) (tokens []domain.LexicalObject, err error) {
+	tokens, err = lexicalAnalyze(arg)
+	return
+}
+
+// Parse ... make syntax tree of tokens made by Lex
+func Parse(tokens []domain.LexicalObject) (ast *domain.Node, err error) {
+	ast, err = parse(tokens)
+	return
+}
+
+// generator ... state of code generation
+type generator struct {
+	program *Program
+	// modifiers ... arg of each modifier op code which is in effect now. it is 0 out of any modifier form
+	modifiers map[OpCode]int64
+}
+
+func genProgram(ast *domain.Node) (program *Program, err error) {
+	if ast == nil || ast.Type != domain.Root {
+		err = fmt.Errorf("internal error: expected root")
+		return
 	}
 
-	switch ast.Type {
-	case domain.Root:
-		magic, err = genRoot(ast)
-		return 
+	gen := &generator{program: &Program{}, modifiers: map[OpCode]int64{}}
+	err = gen.genRoot(ast, newEnvironment(nil))
+	if err != nil {
+		return
 	}
-	return 
+	gen.emit(OpHalt, 0)
+	program = gen.program
+	return
 }
 
-func genRoot(ast *domain.Node) (magic domain.Magic, err error) {
+func (gen *generator) genRoot(ast *domain.Node, env *environment) (err error) {
 	left := ast.Left
 	if left == nil {
 		err = fmt.Errorf("runtime error: unexpected nil left at root")
-		return 
-	} 
+		return
+	}
 
 	switch left.Type{
 	case domain.Operator:
-		magic, err = genOperator(left.Data.Label, ast.Right)
-		return 
+		err = gen.genForm(left, ast.Right, env)
+		return
 	default:
 		err = fmt.Errorf("runtime error: expected operator")
-		return 
+		return
 	}
 }
 
-func genOperator(label domain.DataLabel, operands *domain.Node) (magic domain.Magic, err error) {
-	switch label{
-	case domain.OperatorGandr:
-		// check operands
-		var parameters []int64
-		parameters, err = getParameters(operands, 2)
+// genForm ... generate code of a form which is magic operator, seq of forms or let whose body is a form
+func (gen *generator) genForm(operator *domain.Node, operands *domain.Node, env *environment) (err error) {
+	switch operator.Data.Label {
+	case domain.OperatorLet:
+		var scope *environment
+		var body *domain.Node
+		scope, body, err = gen.genLet(operands, env)
 		if err != nil {
-			return 
-		}
-		magic = domain.Magic{
-			Amount: amountGandr,
-			Target: gruid.Point{X: int(parameters[0]), Y: int(parameters[1])},
-			Radius: radiusGandr,
-			Name: "gandr",
-		}
-		return 
-	case domain.OperatorSeiethr:
-		// check operands
-		var parameters []int64
-		parameters, err = getParameters(operands, 2)
+			return
+		}
+		err = gen.genSubForm(body, scope)
+		return
+	case domain.OperatorSeq:
+		var nodes []*domain.Node
+		nodes, err = getOperands(operands)
 		if err != nil {
-			return 
+			return
+		}
+		if len(nodes) < 1 {
+			err = fmt.Errorf("runtime error: seq expects at least 1 form")
+			return
 		}
-		magic = domain.Magic{
-			Amount: amountSeiethr,
-			Target: gruid.Point{X: int(parameters[0]), Y: int(parameters[1])},
-			Radius: radiusSeiethr,
-			Name: "seiethr",
+		for _, node := range nodes {
+			if err = gen.genSubForm(node, env); err != nil {
+				return
+			}
 		}
-		return 
+		return
+	case domain.OperatorDefine:
+		err = fmt.Errorf("runtime error: define is not a magic. it saves a spell to spell book")
+		return
+	case domain.OperatorIf:
+		_, err = gen.genIf(operands, env, func(node *domain.Node) (typ valueType, err error) {
+			err = gen.genSubForm(node, env)
+			return
+		})
+		return
+	case domain.OperatorShape, domain.OperatorElement:
+		err = gen.genModifier(operator, operands, env)
+		return
+	case domain.OperatorDelay, domain.OperatorPersist:
+		err = gen.genTiming(operator.Data.Label, operands, env)
+		return
+	case domain.OperatorRepeat:
+		err = gen.genRepeat(operands, env)
+		return
 	default:
+		err = gen.genOperator(operator.Data.Label, operator.Data.Text, operands, env)
+		return
+	}
+}
+
+// genSubForm ... generate code of a form nested in other form
+func (gen *generator) genSubForm(node *domain.Node, env *environment) (err error) {
+	if node.Type != domain.Expression || node.Left == nil || node.Left.Type != domain.Operator {
+		err = fmt.Errorf("runtime error: expected form of magic")
+		return
+	}
+	err = gen.genForm(node.Left, node.Right, env)
+	return
+}
+
+// genModifier ... generate code of form whose magics have shape or element named by operator.
+// modifier of outer form is restored after it
+func (gen *generator) genModifier(operator *domain.Node, operands *domain.Node, env *environment) (err error) {
+	op, value, ok := modifier(operator)
+	if !ok {
+		err = fmt.Errorf("runtime error: unknown modifier %s", operator.Data.Text)
+		return
+	}
+	nodes, err := getOperands(operands)
+	if err != nil {
+		return
+	}
+	if len(nodes) != 1 {
+		err = fmt.Errorf("runtime error: %s expects 1 form but got %d", operator.Data.Text, len(nodes))
+		return
+	}
+
+	outer := gen.modifiers[op]
+	gen.modifiers[op] = value
+	gen.emit(op, value)
+	if err = gen.genSubForm(nodes[0], env); err != nil {
+		return
+	}
+	gen.modifiers[op] = outer
+	gen.emit(op, outer)
+	return
+}
+
+// genTiming ... generate code of (delay turns form) or (persist turns form). turns is computed at cast time
+func (gen *generator) genTiming(label domain.DataLabel, operands *domain.Node, env *environment) (err error) {
+	timing := timingDelay
+	if label == domain.OperatorPersist {
+		timing = timingPersist
+	}
+	nodes, err := getOperands(operands)
+	if err != nil {
+		return
+	}
+	if len(nodes) != 2 {
+		err = fmt.Errorf("runtime error: %s expects turns and form", operatorWords[label])
+		return
+	}
+	if err = gen.genNumber(nodes[0], env); err != nil {
+		return
+	}
+	gen.emit(OpBeginTiming, timing)
+	if err = gen.genSubForm(nodes[1], env); err != nil {
+		return
+	}
+	gen.emit(OpEndTiming, timing)
+	return
+}
+
+// genRepeat ... generate loop of (repeat times form). vm caps times and the k-th iteration costs k times mana
+func (gen *generator) genRepeat(operands *domain.Node, env *environment) (err error) {
+	nodes, err := getOperands(operands)
+	if err != nil {
+		return
+	}
+	if len(nodes) != 2 {
+		err = fmt.Errorf("runtime error: repeat expects times and form")
+		return
+	}
+	if err = gen.genNumber(nodes[0], env); err != nil {
+		return
+	}
+	gen.emit(OpBeginRepeat, 0)
+	loop := gen.emit(OpRepeat, 0)
+	if err = gen.genSubForm(nodes[1], env); err != nil {
+		return
+	}
+	gen.emit(OpJump, int64(loop))
+	gen.patch(loop)
+	return
+}
+
+// modifier ... op code and its arg which set what operator named
+func modifier(operator *domain.Node) (op OpCode, value int64, ok bool) {
+	switch operator.Data.Label {
+	case domain.OperatorShape:
+		var shape domain.MagicShape
+		shape, ok = shapes[operator.Data.Text]
+		op, value = OpShape, int64(shape)
+	case domain.OperatorElement:
+		var element domain.Element
+		element, ok = elements[operator.Data.Text]
+		op, value = OpElement, int64(element)
+	}
+	return
+}
+
+// genLet ... generate code to store bindings of let in order. returns scope of the bindings and body of let
+func (gen *generator) genLet(operands *domain.Node, env *environment) (scope *environment, body *domain.Node, err error) {
+	nodes, err := getOperands(operands)
+	if err != nil {
+		return
+	}
+	if len(nodes) != 2 {
+		err = fmt.Errorf("runtime error: let expects bindings and body")
+		return
+	}
+	bindings, err := getOperands(nodes[0])
+	if err != nil {
+		return
+	}
+
+	scope = newEnvironment(env)
+	for _, binding := range bindings {
+		if binding.Type != domain.Binding || binding.Left == nil {
+			err = fmt.Errorf("internal error: unexpected type %d at bindings of let", binding.Type)
+			return
+		}
+		var typ valueType
+		typ, err = gen.genExpression(binding.Left, scope)
+		if err != nil {
+			return
+		}
+		// value of environment is slot of the variable. point is stored as x, y in 2 slots
+		slot := int64(gen.program.Slots)
+		gen.program.Slots += typ.width()
+		for i := typ.width() - 1; i >= 0; i-- {
+			gen.emit(OpStore, slot+int64(i))
+		}
+		scope.define(binding.Data.Text, variable{slot: slot, typ: typ})
+	}
+	body = nodes[1]
+	return
+}
+
+// genOperator ... generate code which emits magic of operator in registry
+func (gen *generator) genOperator(label domain.DataLabel, name string, operands *domain.Node, env *environment) (err error) {
+	if label != domain.OperatorSpell {
 		err = fmt.Errorf("runtime error: expected operator")
-		return 
+		return
+	}
+	op, ok := operators[name]
+	if !ok {
+		err = fmt.Errorf("runtime error: unknown magic %s", name)
+		return
+	}
+
+	nodes, err := getOperands(operands)
+	if err != nil {
+		return
+	}
+	types := []valueType{}
+	for _, node := range nodes {
+		var typ valueType
+		if typ, err = gen.genExpression(node, env); err != nil {
+			return
+		}
+		// string operand of magic is name of entity to target
+		if typ == typeString {
+			gen.emit(OpCall, gen.stringIndex("nearest-named"))
+			typ = typePoint
+		}
+		types = append(types, typ)
+	}
+	if !op.matchParams(types) {
+		err = fmt.Errorf("runtime error: %s expects %s", name, op.usage())
+		return
 	}
+	gen.emit(OpMagic, gen.stringIndex(name))
+	return
 }
 
-func getParameters(operands *domain.Node, length int) (parameters []int64, err error) {
-	if length > 0 {
-		if operands == nil {
-			err = fmt.Errorf("runtime error: expected list of length %d but got null list", length)
-			return 
+// genParameters ... generate code which pushes each of operands. returns types of them
+func (gen *generator) genParameters(operands *domain.Node, env *environment) (types []valueType, err error) {
+	nodes, err := getOperands(operands)
+	if err != nil {
+		return
+	}
+	for _, node := range nodes {
+		var typ valueType
+		typ, err = gen.genExpression(node, env)
+		if err != nil {
+			return
 		}
-		if operands.Type != domain.ArrayHead {
-			err = fmt.Errorf("runtime error: expected list")
-			return 
+		types = append(types, typ)
+	}
+	return
+}
+
+// genBuiltin ... generate code which calls builtin named name
+func (gen *generator) genBuiltin(name string, operands *domain.Node, env *environment) (typ valueType, err error) {
+	b, ok := builtins[name]
+	if !ok {
+		err = fmt.Errorf("runtime error: unknown function %s", name)
+		return
+	}
+	types, err := gen.genParameters(operands, env)
+	if err != nil {
+		return
+	}
+	if !sameTypes(types, b.params) {
+		err = fmt.Errorf("runtime error: %s expects %s", name, typeList(b.params))
+		return
+	}
+	gen.emit(OpCall, gen.stringIndex(name))
+	typ = b.result
+	return
+}
+
+func sameTypes(a, b []valueType) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
 		}
-		operands = operands.Right
+	}
+	return true
+}
 
-		i := 0
-		for {
-			if operands == nil {
-				err = fmt.Errorf("internal error: unexpected nil at operands")
-				return 
-			}
+// typeList ... describe types for error message
+func typeList(types []valueType) (s string) {
+	if len(types) == 0 {
+		s = "no operand"
+		return
+	}
+	for i, t := range types {
+		if i > 0 {
+			s += ", "
+		}
+		s += t.String()
+	}
+	return
+}
 
-			if operands.Type == domain.ArrayTail {
-				if i != length {
-					err = fmt.Errorf("runtime error: expect %d operands but got %d", length, i)
-					return 
-				}
-				return 
-			}
+// getOperands ... collect operand nodes from list
+func getOperands(operands *domain.Node) (nodes []*domain.Node, err error) {
+	if operands == nil {
+		err = fmt.Errorf("runtime error: expected list but got null list")
+		return
+	}
+	if operands.Type != domain.ArrayHead {
+		err = fmt.Errorf("runtime error: expected list")
+		return
+	}
+	operands = operands.Right
 
-			if operands.Type == domain.ArrayItem {
-				// error check
-				if operands.Left == nil {
-					err = fmt.Errorf("internal error: unexpected nil at ArrayItem.Left")
-					return 
-				}
-				if operands.Left.Type != domain.Literal {
-					err = fmt.Errorf("runtime error: unexpected type of operands")
-					return 
-				}
-
-				parameters = append(parameters, operands.Left.Data.Number)
-				operands = operands.Right
-				i++
-				continue 
+	for {
+		if operands == nil {
+			err = fmt.Errorf("internal error: unexpected nil at operands")
+			return
+		}
+
+		switch operands.Type {
+		case domain.ArrayTail:
+			return
+		case domain.ArrayItem:
+			if operands.Left == nil {
+				err = fmt.Errorf("internal error: unexpected nil at ArrayItem.Left")
+				return
 			}
+			nodes = append(nodes, operands.Left)
+			operands = operands.Right
+		default:
 			err = fmt.Errorf("internal error: unexpected type %d at getOperands", operands.Type)
+			return
+		}
+	}
+}
+
+// genExpression ... generate code which pushes value of operand. returns type of the value
+func (gen *generator) genExpression(node *domain.Node, env *environment) (typ valueType, err error) {
+	switch node.Type {
+	case domain.Literal:
+		switch node.Data.Label {
+		case domain.Number:
+			gen.emit(OpPush, node.Data.Number)
+			typ = typeNumber
+		case domain.String:
+			gen.emit(OpString, gen.stringIndex(node.Data.Text))
+			typ = typeString
+		default:
+			err = fmt.Errorf("runtime error: unexpected type of operands")
+		}
+		return
+	case domain.Variable:
+		v, ok := env.lookup(node.Data.Text)
+		if !ok {
+			err = fmt.Errorf("runtime error: %s is not defined", node.Data.Text)
+			return
+		}
+		for i := 0; i < v.typ.width(); i++ {
+			gen.emit(OpLoad, v.slot+int64(i))
+		}
+		typ = v.typ
+		return
+	case domain.Expression:
+		if node.Left == nil || node.Left.Type != domain.Operator {
+			err = fmt.Errorf("runtime error: expected operator")
+			return
+		}
+		if node.Left.Data.Label == domain.OperatorLet {
+			var scope *environment
+			var body *domain.Node
+			scope, body, err = gen.genLet(node.Right, env)
+			if err != nil {
+				return
+			}
+			typ, err = gen.genExpression(body, scope)
+			return
+		}
+		switch node.Left.Data.Label {
+		case domain.OperatorBuiltin:
+			typ, err = gen.genBuiltin(node.Left.Data.Text, node.Right, env)
+			return
+		case domain.OperatorIf:
+			typ, err = gen.genIf(node.Right, env, func(node *domain.Node) (valueType, error) {
+				return gen.genExpression(node, env)
+			})
+			return
+		case domain.OperatorLess, domain.OperatorLessEqual, domain.OperatorGreater, domain.OperatorGreaterEqual, domain.OperatorEqual:
+			typ = typeNumber
+			err = gen.genComparison(node.Left.Data.Label, node.Right, env)
+			return
+		}
+		typ = typeNumber
+		err = gen.genArithmetic(node.Left.Data.Label, node.Right, env)
+		return
+	default:
+		err = fmt.Errorf("runtime error: unexpected type of operands")
+		return
+	}
+}
+
+// genArithmetic ... generate code which folds operands by arithmetic operator from left
+func (gen *generator) genArithmetic(label domain.DataLabel, operands *domain.Node, env *environment) (err error) {
+	var op OpCode
+	switch label {
+	case domain.OperatorAdd:
+		op = OpAdd
+	case domain.OperatorSub:
+		op = OpSub
+	case domain.OperatorMul:
+		op = OpMul
+	case domain.OperatorDiv:
+		op = OpDiv
+	default:
+		err = fmt.Errorf("runtime error: expected arithmetic operator")
+		return
+	}
+
+	nodes, err := getOperands(operands)
+	if err != nil {
+		return
+	}
+	if len(nodes) < 1 {
+		err = fmt.Errorf("runtime error: expect at least 1 operand but got 0")
+		return
+	}
+	if op == OpDiv && len(nodes) < 2 {
+		err = fmt.Errorf("runtime error: expect at least 2 operands but got 1")
+		return
+	}
+
+	if err = gen.genNumber(nodes[0], env); err != nil {
+		return
+	}
+	// (- x) is negation
+	if op == OpSub && len(nodes) == 1 {
+		gen.emit(OpNeg, 0)
+		return
+	}
+	for _, node := range nodes[1:] {
+		if err = gen.genNumber(node, env); err != nil {
+			return
 		}
+		gen.emit(op, 0)
 	}
-	return 
-}
\ No newline at end of file
+	return
+}
+
+// genIf ... generate code which runs one of branches by condition. genBranch generates code of each branch.
+// both branches must make value of the same type
+func (gen *generator) genIf(conditional *domain.Node, env *environment, genBranch func(node *domain.Node) (valueType, error)) (typ valueType, err error) {
+	if conditional == nil || conditional.Type != domain.Conditional || conditional.Right == nil || conditional.Right.Type != domain.Branch {
+		err = fmt.Errorf("internal error: expected conditional")
+		return
+	}
+	if err = gen.genNumber(conditional.Left, env); err != nil {
+		return
+	}
+	jumpToElse := gen.emit(OpJumpIfZero, 0)
+	typ, err = genBranch(conditional.Right.Left)
+	if err != nil {
+		return
+	}
+	jumpToEnd := gen.emit(OpJump, 0)
+	gen.patch(jumpToElse)
+	elseType, err := genBranch(conditional.Right.Right)
+	if err != nil {
+		return
+	}
+	gen.patch(jumpToEnd)
+	if typ != elseType {
+		err = fmt.Errorf("runtime error: branches of if are %s and %s", typ, elseType)
+	}
+	return
+}
+
+// genComparison ... generate code which compares 2 numbers
+func (gen *generator) genComparison(label domain.DataLabel, operands *domain.Node, env *environment) (err error) {
+	var op OpCode
+	switch label {
+	case domain.OperatorLess:
+		op = OpLess
+	case domain.OperatorLessEqual:
+		op = OpLessEqual
+	case domain.OperatorGreater:
+		op = OpGreater
+	case domain.OperatorGreaterEqual:
+		op = OpGreaterEqual
+	case domain.OperatorEqual:
+		op = OpEqual
+	default:
+		err = fmt.Errorf("runtime error: expected comparison operator")
+		return
+	}
+
+	nodes, err := getOperands(operands)
+	if err != nil {
+		return
+	}
+	if len(nodes) != 2 {
+		err = fmt.Errorf("runtime error: expect 2 operands but got %d", len(nodes))
+		return
+	}
+	for _, node := range nodes {
+		if err = gen.genNumber(node, env); err != nil {
+			return
+		}
+	}
+	gen.emit(op, 0)
+	return
+}
+
+// genNumber ... generate code of expression which must be number
+func (gen *generator) genNumber(node *domain.Node, env *environment) (err error) {
+	typ, err := gen.genExpression(node, env)
+	if err != nil {
+		return
+	}
+	if typ != typeNumber {
+		err = fmt.Errorf("runtime error: expected number but got %s", typ)
+	}
+	return
+}
+
+// emit ... append instruction and return its address
+func (gen *generator) emit(op OpCode, arg int64) (at int) {
+	gen.program.Code = append(gen.program.Code, Instruction{Op: op, Arg: arg})
+	at = len(gen.program.Code) - 1
+	return
+}
+
+// patch ... make jump at address at go to next instruction to be emitted
+func (gen *generator) patch(at int) {
+	gen.program.Code[at].Arg = int64(len(gen.program.Code))
+}
+
+// stringIndex ... index of s in constant pool. s is added if it is not in the pool
+func (gen *generator) stringIndex(s string) (index int64) {
+	for i, t := range gen.program.Strings {
+		if t == s {
+			index = int64(i)
+			return
+		}
+	}
+	gen.program.Strings = append(gen.program.Strings, s)
+	index = int64(len(gen.program.Strings) - 1)
+	return
+}
@@ -8,34 +8,422 @@ import (
 	"github.com/stretchr/testify/assert"
 )
 
+// operators in default registry
+var (
+	gandr = operators["gandr"]
+	seiethr = operators["seiethr"]
+)
 
 func TestCompiler(t *testing.T) {
 	type TestItem struct {
 		Arg string 
 		IsSuccess bool 
-		ExpectedMagic domain.Magic
+		ExpectedMagics []domain.Magic
 	}
 	table := map[string] TestItem{
 		"success: gandr 1 2": {
 			Arg: "(gandr 1 2)",
 			IsSuccess: true,
-			ExpectedMagic: domain.Magic{
-				Amount: amountGandr,
+			ExpectedMagics: []domain.Magic{{
+				Amount: gandr.Amount,
+				Damage: gandr.Power,
 				Target: gruid.Point{X: 1, Y: 2},
-				Radius: radiusGandr,
+				Radius: gandr.Radius,
+				Name: "gandr",
+			}},
+		},
+		"success: arithmetic operands": {
+			Arg: "(seiethr (* 2 (- 3 1)) (- 2))",
+			IsSuccess: true,
+			ExpectedMagics: []domain.Magic{{
+				Amount: seiethr.Amount,
+				Damage: seiethr.Power,
+				Target: gruid.Point{X: 4, Y: -2},
+				Radius: seiethr.Radius,
+				Name: "seiethr",
+			}},
+		},
+		"success: variadic and division": {
+			Arg: "(gandr (+ 1 2 3) (/ 7 2))",
+			IsSuccess: true,
+			ExpectedMagics: []domain.Magic{{
+				Amount: gandr.Amount,
+				Damage: gandr.Power,
+				Target: gruid.Point{X: 6, Y: 3},
+				Radius: gandr.Radius,
 				Name: "gandr",
+			}},
+		},
+		"success: let": {
+			Arg: "(let ((dx 3) (dy -2)) (gandr dx dy))",
+			IsSuccess: true,
+			ExpectedMagics: []domain.Magic{{
+				Amount: gandr.Amount,
+				Damage: gandr.Power,
+				Target: gruid.Point{X: 3, Y: -2},
+				Radius: gandr.Radius,
+				Name: "gandr",
+			}},
+		},
+		"success: bindings refer former bindings": {
+			Arg: "(let ((d 2) (dx (* d 2))) (let ((d 1)) (seiethr dx (- d))))",
+			IsSuccess: true,
+			ExpectedMagics: []domain.Magic{{
+				Amount: seiethr.Amount,
+				Damage: seiethr.Power,
+				Target: gruid.Point{X: 4, Y: -1},
+				Radius: seiethr.Radius,
+				Name: "seiethr",
+			}},
+		},
+		"success: let in operand": {
+			Arg: "(gandr (let ((a 5)) (+ a a)) 0)",
+			IsSuccess: true,
+			ExpectedMagics: []domain.Magic{{
+				Amount: gandr.Amount,
+				Damage: gandr.Power,
+				Target: gruid.Point{X: 10, Y: 0},
+				Radius: gandr.Radius,
+				Name: "gandr",
+			}},
+		},
+		"success: several forms": {
+			Arg: "(gandr 1 0) (seiethr 3 0)",
+			IsSuccess: true,
+			ExpectedMagics: []domain.Magic{
+				{Amount: gandr.Amount, Damage: gandr.Power, Target: gruid.Point{X: 1, Y: 0}, Radius: gandr.Radius, Name: "gandr"},
+				{Amount: seiethr.Amount, Damage: seiethr.Power, Target: gruid.Point{X: 3, Y: 0}, Radius: seiethr.Radius, Name: "seiethr"},
+			},
+		},
+		"success: seq in let": {
+			Arg: "(let ((d 2)) (seq (gandr d 0) (seq (gandr 0 d)) (seiethr d d)))",
+			IsSuccess: true,
+			ExpectedMagics: []domain.Magic{
+				{Amount: gandr.Amount, Damage: gandr.Power, Target: gruid.Point{X: 2, Y: 0}, Radius: gandr.Radius, Name: "gandr"},
+				{Amount: gandr.Amount, Damage: gandr.Power, Target: gruid.Point{X: 0, Y: 2}, Radius: gandr.Radius, Name: "gandr"},
+				{Amount: seiethr.Amount, Damage: seiethr.Power, Target: gruid.Point{X: 2, Y: 2}, Radius: seiethr.Radius, Name: "seiethr"},
+			},
+		},
+		"error: overflow of multiplication": {
+			Arg: "(gandr (* 9223372036854775807 2) 0)",
+			IsSuccess: false,
+		},
+		"error: overflow of negation": {
+			Arg: "(let ((x (- (- 9223372036854775807) 1))) (gandr (- x) 0))",
+			IsSuccess: false,
+		},
+		"error: target out of sight": {
+			Arg: "(let ((x 11)) (gandr x 0))",
+			IsSuccess: false,
+		},
+		"error: empty seq": {
+			Arg: "(seq)",
+			IsSuccess: false,
+		},
+		"error: number in seq": {
+			Arg: "(seq (gandr 1 0) 3)",
+			IsSuccess: false,
+		},
+		"error: undefined name": {
+			Arg: "(let ((dx 3)) (gandr dx dy))",
+			IsSuccess: false,
+		},
+		"error: name out of scope": {
+			Arg: "(gandr (let ((a 1)) a) a)",
+			IsSuccess: false,
+		},
+		"error: division by zero": {
+			Arg: "(gandr (/ 1 0) 2)",
+			IsSuccess: false,
+		},
+		"error: arithmetic is not magic": {
+			Arg: "(+ 1 2)",
+			IsSuccess: false,
+		},
+		"error: unclosed expression": {
+			Arg: "(gandr (+ 1 2",
+			IsSuccess: false,
+		},
+		"success: if": {
+			Arg: "(if (< 1 2) (gandr 1 0) (seiethr 2 0))",
+			IsSuccess: true,
+			ExpectedMagics: []domain.Magic{
+				{Amount: gandr.Amount, Damage: gandr.Power, Target: gruid.Point{X: 1, Y: 0}, Radius: gandr.Radius, Name: "gandr"},
+			},
+		},
+		"success: else and if in operand": {
+			Arg: "(let ((d 3)) (if (= d 2) (gandr 1 0) (seiethr (if (> d 2) d 0) (if (<= d 2) 1 -1))))",
+			IsSuccess: true,
+			ExpectedMagics: []domain.Magic{
+				{Amount: seiethr.Amount, Damage: seiethr.Power, Target: gruid.Point{X: 3, Y: -1}, Radius: seiethr.Radius, Name: "seiethr"},
+			},
+		},
+		"error: branches of different types": {
+			Arg: "(gandr (if 1 2 (gandr 1 0)) 0)",
+			IsSuccess: false,
+		},
+		"error: comparison of 3 numbers": {
+			Arg: "(if (< 1 2 3) (gandr 1 0) (gandr 0 1))",
+			IsSuccess: false,
+		},
+		"error: query without game": {
+			Arg: "(gandr (nearest-enemy))",
+			IsSuccess: false,
+		},
+		"error: point in arithmetic": {
+			Arg: "(gandr (+ (nearest-enemy) 1) 0)",
+			IsSuccess: false,
+		},
+		"error: point and number as target": {
+			Arg: "(gandr (nearest-enemy) 0)",
+			IsSuccess: false,
+		},
+		"error: missing operand of builtin": {
+			Arg: "(gandr (enemy-count-in) 0)",
+			IsSuccess: false,
+		},
+		"success: nested shapes": {
+			Arg: "(cross (seq (gandr 1 0) (line (gandr 2 0)) (gandr 3 0)))",
+			IsSuccess: true,
+			ExpectedMagics: []domain.Magic{
+				{Amount: gandr.Amount, Damage: gandr.Power, Target: gruid.Point{X: 1}, Shape: domain.ShapeCross, Name: "gandr"},
+				{Amount: gandr.Amount, Damage: gandr.Power, Target: gruid.Point{X: 2}, Shape: domain.ShapeLine, Name: "gandr"},
+				{Amount: gandr.Amount, Damage: gandr.Power, Target: gruid.Point{X: 3}, Shape: domain.ShapeCross, Name: "gandr"},
+			},
+		},
+		"success: shape in if": {
+			Arg: "(seq (if 1 (cone (gandr 4 1)) (gandr 0 1)) (gandr 1 1))",
+			IsSuccess: true,
+			ExpectedMagics: []domain.Magic{
+				{Amount: gandr.Amount, Damage: gandr.Power, Target: gruid.Point{X: 4, Y: 1}, Shape: domain.ShapeCone, Name: "gandr"},
+				{Amount: gandr.Amount, Damage: gandr.Power, Target: gruid.Point{X: 1, Y: 1}, Name: "gandr"},
+			},
+		},
+		"success: element and shape": {
+			Arg: "(seq (fire (line (seq (gandr 1 0) (frost (gandr 2 0))))) (gandr 3 0))",
+			IsSuccess: true,
+			ExpectedMagics: []domain.Magic{
+				{Amount: gandr.Amount, Damage: gandr.Power, Target: gruid.Point{X: 1}, Shape: domain.ShapeLine, Element: domain.ElementFire, Name: "gandr"},
+				{Amount: gandr.Amount, Damage: gandr.Power, Target: gruid.Point{X: 2}, Shape: domain.ShapeLine, Element: domain.ElementFrost, Name: "gandr"},
+				{Amount: gandr.Amount, Damage: gandr.Power, Target: gruid.Point{X: 3}, Name: "gandr"},
+			},
+		},
+		"success: delay and persist": {
+			Arg: "(delay 2 (seq (persist (+ 1 2) (seiethr 0 2)) (delay 1 (gandr 1 0))))",
+			IsSuccess: true,
+			ExpectedMagics: []domain.Magic{
+				{Amount: seiethr.Amount * 4, Damage: seiethr.Power, Target: gruid.Point{Y: 2}, Radius: seiethr.Radius, Delay: 2, Duration: 3, Name: "seiethr"},
+				{Amount: gandr.Amount, Damage: gandr.Power, Target: gruid.Point{X: 1}, Delay: 3, Name: "gandr"},
 			},
 		},
+		"success: repeat escalates cost": {
+			Arg: "(repeat 3 (fire (gandr 1 0)))",
+			IsSuccess: true,
+			ExpectedMagics: []domain.Magic{
+				{Amount: gandr.Amount, Damage: gandr.Power, Target: gruid.Point{X: 1}, Element: domain.ElementFire, Name: "gandr"},
+				{Amount: gandr.Amount * 2, Damage: gandr.Power, Target: gruid.Point{X: 1}, Element: domain.ElementFire, Name: "gandr"},
+				{Amount: gandr.Amount * 3, Damage: gandr.Power, Target: gruid.Point{X: 1}, Element: domain.ElementFire, Name: "gandr"},
+			},
+		},
+		"success: nested repeat and persist": {
+			Arg: "(repeat 2 (seq (gandr 1 0) (repeat 2 (persist 1 (gandr 2 0)))))",
+			IsSuccess: true,
+			ExpectedMagics: []domain.Magic{
+				{Amount: gandr.Amount, Damage: gandr.Power, Target: gruid.Point{X: 1}, Name: "gandr"},
+				{Amount: gandr.Amount * 2, Damage: gandr.Power, Target: gruid.Point{X: 2}, Duration: 1, Name: "gandr"},
+				{Amount: gandr.Amount * 4, Damage: gandr.Power, Target: gruid.Point{X: 2}, Duration: 1, Name: "gandr"},
+				{Amount: gandr.Amount * 2, Damage: gandr.Power, Target: gruid.Point{X: 1}, Name: "gandr"},
+				{Amount: gandr.Amount * 4, Damage: gandr.Power, Target: gruid.Point{X: 2}, Duration: 1, Name: "gandr"},
+				{Amount: gandr.Amount * 8, Damage: gandr.Power, Target: gruid.Point{X: 2}, Duration: 1, Name: "gandr"},
+			},
+		},
+		"error: repeat over max": {
+			Arg: "(repeat 6 (gandr 1 0))",
+			IsSuccess: false,
+		},
+		"error: repeat of zero": {
+			Arg: "(repeat 0 (gandr 1 0))",
+			IsSuccess: false,
+		},
+		"error: repeat times decided at cast time": {
+			Arg: "(repeat (enemy-count-in 3) (gandr 1 0))",
+			IsSuccess: false,
+		},
+		"error: negative delay": {
+			Arg: "(delay (- 1) (gandr 1 0))",
+			IsSuccess: false,
+		},
+		"error: delay over max turns": {
+			Arg: "(delay 6 (delay 5 (gandr 1 0)))",
+			IsSuccess: false,
+		},
+		"error: delay without turns": {
+			Arg: "(delay (gandr 1 0))",
+			IsSuccess: false,
+		},
+		"error: element of number": {
+			Arg: "(gandr (lightning 1) 0)",
+			IsSuccess: false,
+		},
+		"error: shape of 2 forms": {
+			Arg: "(line (gandr 1 0) (gandr 2 0))",
+			IsSuccess: false,
+		},
+		"error: shape of number": {
+			Arg: "(gandr (circle 1) 0)",
+			IsSuccess: false,
+		},
 	}
 
 	for key, item := range table {
-		magic ,err := Compile(item.Arg)
+		magics ,err := Compile(item.Arg)
 		if item.IsSuccess && err != nil {
 			t.Fatal(err)
 		}
 
+		if !item.IsSuccess {
+			assert.NotNil(t, err, key)
+		}
+
 		if item.IsSuccess {
-			assert.Equal(t, item.ExpectedMagic, magic, key)
+			assert.Equal(t, item.ExpectedMagics, magics, key)
 		}
 	}
 }
+
+func TestCompileWith(t *testing.T) {
+	type TestItem struct {
+		Arg string
+		IsSuccess bool
+		ExpectedTargets []gruid.Point
+	}
+	w := testWorld{
+		caster: 1,
+		position: gruid.Point{X: 5, Y: 5},
+		player: gruid.Point{X: 5, Y: 5},
+		hostiles: []gruid.Point{{X: 9, Y: 5}, {X: 5, Y: 3}, {X: 3, Y: 5}},
+		named: map[string][]gruid.Point{
+			"troll": {{X: 9, Y: 5}, {X: 3, Y: 5}},
+			"old \"orc\"": {{X: 5, Y: 3}},
+		},
+	}
+	table := map[string]TestItem{
+		"success: nearest enemy": {
+			Arg: "(gandr (nearest-enemy))",
+			IsSuccess: true,
+			ExpectedTargets: []gruid.Point{{X: 0, Y: -2}},
+		},
+		"success: point variable": {
+			Arg: "(let ((e (nearest-enemy)) (n (enemy-count-in 2))) (seq (gandr e) (gandr n (player-y))))",
+			IsSuccess: true,
+			ExpectedTargets: []gruid.Point{{X: 0, Y: -2}, {X: 2, Y: 0}},
+		},
+		"success: enemy count": {
+			Arg: "(gandr (enemy-count-in 4) (player-x))",
+			IsSuccess: true,
+			ExpectedTargets: []gruid.Point{{X: 3, Y: 0}},
+		},
+		"success: seiethr if 3 enemies in radius": {
+			Arg: "(if (>= (enemy-count-in 4) 3) (seiethr 0 0) (gandr (nearest-enemy)))",
+			IsSuccess: true,
+			ExpectedTargets: []gruid.Point{{X: 0, Y: 0}},
+		},
+		"success: gandr unless 3 enemies in radius": {
+			Arg: "(if (>= (enemy-count-in 2) 3) (seiethr 0 0) (gandr (nearest-enemy)))",
+			IsSuccess: true,
+			ExpectedTargets: []gruid.Point{{X: 0, Y: -2}},
+		},
+		"success: target by name": {
+			Arg: `(gandr "troll") ; the nearest troll`,
+			IsSuccess: true,
+			ExpectedTargets: []gruid.Point{{X: -2, Y: 0}},
+		},
+		"success: name with escapes in variable": {
+			Arg: `(let ((name "old \"orc\"")) (gandr name))`,
+			IsSuccess: true,
+			ExpectedTargets: []gruid.Point{{X: 0, Y: -2}},
+		},
+		"error: nobody of the name": {
+			Arg: `(gandr "dragon")`,
+			IsSuccess: false,
+		},
+		"error: string in arithmetic": {
+			Arg: `(gandr (+ "troll" 1) 0)`,
+			IsSuccess: false,
+		},
+		"error: negative distance": {
+			Arg: "(gandr (enemy-count-in -1) 0)",
+			IsSuccess: false,
+		},
+	}
+
+	for key, item := range table {
+		magics, err := CompileWith(item.Arg, w)
+		if !item.IsSuccess {
+			assert.NotNil(t, err, key)
+			continue
+		}
+		if err != nil {
+			t.Fatal(key, err)
+		}
+		targets := []gruid.Point{}
+		for _, magic := range magics {
+			assert.Equal(t, w.caster, magic.Actor, key)
+			targets = append(targets, magic.Target)
+		}
+		assert.Equal(t, item.ExpectedTargets, targets, key)
+	}
+
+	_, err := CompileWith("(gandr (nearest-enemy))", testWorld{})
+	assert.NotNil(t, err, "no enemy in sight")
+}
+
+func TestCompileWithVocabulary(t *testing.T) {
+	type TestItem struct {
+		Spell string
+		IsSuccess bool
+		ExpectedColumn int
+	}
+	w := testWorld{words: map[string]bool{"gandr": true, "fire": true}}
+	table := map[string]TestItem{
+		"success: known words": {"(fire (gandr 1 2))", true, 0},
+		"success: core words are known": {"(let ((x 1)) (seq (gandr x 0) (if (< x 2) (gandr 0 x) (gandr x x))))", true, 0},
+		"fail: unknown magic": {"(seiethr 1 2)", false, 1},
+		"fail: unknown builtin": {"(gandr (nearest-enemy))", false, 8},
+		"fail: unknown modifier": {"(fire (delay 1 (gandr 1 2)))", false, 7},
+		"fail: target by name without nearest-named": {`(gandr "orc")`, false, 7},
+	}
+
+	for key, item := range table {
+		_, err := CompileWith(item.Spell, w)
+		if item.IsSuccess {
+			assert.Nil(t, err, key)
+			continue
+		}
+		var d *Diagnostic
+		if assert.ErrorAs(t, err, &d, key) {
+			assert.Equal(t, item.ExpectedColumn, d.Position().Column, key)
+			assert.Contains(t, d.Error(), "you don't know this word", key)
+		}
+	}
+
+	_, err := Compile("(seiethr 1 2)")
+	assert.Nil(t, err, "caster without world knows every word")
+
+	named := testWorld{
+		words: map[string]bool{"gandr": true, "nearest-named": true},
+		named: map[string][]gruid.Point{"orc": {{X: 1, Y: 0}}},
+	}
+	_, err = CompileWith(`(gandr "orc")`, named)
+	assert.Nil(t, err, "caster who knows nearest-named targets by name")
+}
+
+func TestLearnableWords(t *testing.T) {
+	words := LearnableWords()
+	for _, w := range []string{"gandr", "nearest-enemy", "line", "fire", "delay", "persist"} {
+		assert.Contains(t, words, w)
+	}
+	for _, w := range []string{"let", "if", "seq", "define"} {
+		assert.NotContains(t, words, w)
+	}
+}
@@ -0,0 +1,139 @@
+package compiler
+
+import (
+	"domain"
+	"strconv"
+	"strings"
+)
+
+// decompileMagic ... make source of spell which compiles to magic cast alone. target is written as relative numbers
+// and form of magic is wrapped by its shape unless it is circle, by its element unless it is physical
+// and by delay and persist if it takes effect later.
+// magic which is not made by an operator in registry is written as its name and target.
+// Amount is not written, so magic of repeat whose cost grows with iterations is kept only by DecompileAll
+func decompileMagic(magic domain.Magic) (source string) {
+	b := &strings.Builder{}
+	b.WriteString("(")
+	b.WriteString(magic.Name)
+	op, ok := operators[magic.Name]
+	if !ok {
+		op = Operator{Params: []string{paramTarget}}
+	}
+	for _, p := range op.Params {
+		switch p {
+		case paramTarget:
+			b.WriteString(" " + strconv.Itoa(magic.Target.X))
+			b.WriteString(" " + strconv.Itoa(magic.Target.Y))
+		}
+	}
+	b.WriteString(")")
+	source = b.String()
+	if magic.Shape != domain.ShapeCircle {
+		source = "(" + magic.Shape.String() + " " + source + ")"
+	}
+	if magic.Element != domain.ElementPhysical {
+		source = "(" + magic.Element.String() + " " + source + ")"
+	}
+	if magic.Duration > 0 {
+		source = "(persist " + strconv.Itoa(magic.Duration) + " " + source + ")"
+	}
+	if magic.Delay > 0 {
+		source = "(delay " + strconv.Itoa(magic.Delay) + " " + source + ")"
+	}
+	return
+}
+
+// DecompileAll ... make source of spell which compiles to magics in order. magics whose costs grow with
+// iterations are written as repeat of the magics of its first iteration, which may be seq or another repeat.
+// if costs are not made by any repeat, each magic is written alone and its cost is not kept
+func DecompileAll(magics []domain.Magic) (source string) {
+	d := &decompiler{magics: magics, memo: map[[2]int]decompiled{}}
+	forms, ok := d.forms(0, len(magics))
+	if !ok {
+		forms = []string{}
+		for _, magic := range magics {
+			forms = append(forms, decompileMagic(magic))
+		}
+	}
+	switch len(forms) {
+	case 0:
+	case 1:
+		source = forms[0]
+	default:
+		source = "(seq " + strings.Join(forms, " ") + ")"
+	}
+	return
+}
+
+// decompiler ... magics to decompile and forms decompiled from ranges of them so far
+type decompiler struct {
+	magics []domain.Magic
+	memo   map[[2]int]decompiled
+}
+
+// decompiled ... forms of a range of magics. ok is false if the range compiles back from no forms
+type decompiled struct {
+	forms []string
+	ok    bool
+}
+
+// forms ... forms which compile back to magics from start to end as they are. each repeat is tried
+// before a magic is written alone because the magic alone does not keep cost of later iterations
+func (d *decompiler) forms(start, end int) (forms []string, ok bool) {
+	if start == end {
+		return []string{}, true
+	}
+	key := [2]int{start, end}
+	if v, done := d.memo[key]; done {
+		return v.forms, v.ok
+	}
+	defer func() {
+		d.memo[key] = decompiled{forms: forms, ok: ok}
+	}()
+	for length := 1; length <= end-start; length++ {
+		for times := domain.MaxRepeat; times > 1; times-- {
+			if start+length*times > end || !d.repeats(start, length, times) {
+				continue
+			}
+			body, bodyOK := d.forms(start, start+length)
+			if !bodyOK {
+				continue
+			}
+			rest, restOK := d.forms(start+length*times, end)
+			if !restOK {
+				continue
+			}
+			form := body[0]
+			if len(body) > 1 {
+				form = "(seq " + strings.Join(body, " ") + ")"
+			}
+			forms = append([]string{"(repeat " + strconv.Itoa(times) + " " + form + ")"}, rest...)
+			ok = true
+			return
+		}
+	}
+	magic := d.magics[start]
+	if op, registered := operators[magic.Name]; registered && magic.Amount != op.Amount*(magic.Duration+1) {
+		return
+	}
+	rest, ok := d.forms(start+1, end)
+	if ok {
+		forms = append([]string{decompileMagic(magic)}, rest...)
+	}
+	return
+}
+
+// repeats ... magics from start are times iterations of the first length magics.
+// repeat multiplies cost of each magic in k-th iteration by k
+func (d *decompiler) repeats(start, length, times int) bool {
+	for k := 1; k < times; k++ {
+		for i := 0; i < length; i++ {
+			expected := d.magics[start+i]
+			expected.Amount *= k + 1
+			if d.magics[start+k*length+i] != expected {
+				return false
+			}
+		}
+	}
+	return true
+}
@@ -0,0 +1,126 @@
+package compiler
+
+import (
+	"domain"
+	"testing"
+
+	"github.com/anaseto/gruid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecompile(t *testing.T) {
+	type TestItem struct {
+		Magic domain.Magic
+		ExpectedSource string
+	}
+	table := map[string]TestItem{
+		"target": {
+			Magic: domain.Magic{Amount: 5, Damage: 5, Target: gruid.Point{X: 1, Y: -2}, Name: "gandr"},
+			ExpectedSource: "(gandr 1 -2)",
+		},
+		"shape": {
+			Magic: domain.Magic{Amount: 10, Damage: 10, Target: gruid.Point{Y: 3}, Radius: 3, Shape: domain.ShapeCross, Name: "seiethr"},
+			ExpectedSource: "(cross (seiethr 0 3))",
+		},
+		"element": {
+			Magic: domain.Magic{Amount: 5, Damage: 5, Target: gruid.Point{X: 1}, Shape: domain.ShapeLine, Element: domain.ElementLightning, Name: "gandr"},
+			ExpectedSource: "(lightning (line (gandr 1 0)))",
+		},
+		"timing": {
+			Magic: domain.Magic{Amount: 15, Damage: 5, Target: gruid.Point{X: 1}, Element: domain.ElementFire, Delay: 3, Duration: 2, Name: "gandr"},
+			ExpectedSource: "(delay 3 (persist 2 (fire (gandr 1 0))))",
+		},
+		"unknown operator": {
+			Magic: domain.Magic{Target: gruid.Point{X: 3, Y: 4}, Name: "fimbul"},
+			ExpectedSource: "(fimbul 3 4)",
+		},
+	}
+
+	for key, item := range table {
+		assert.Equal(t, item.ExpectedSource, decompileMagic(item.Magic), key)
+	}
+}
+
+// TestDecompileRoundTrip ... every magic of registry in sight compiles back from its source
+func TestDecompileRoundTrip(t *testing.T) {
+	for name, op := range operators {
+		for x := -domain.MaxLOS; x <= domain.MaxLOS; x++ {
+			for y := -domain.MaxLOS; y <= domain.MaxLOS; y++ {
+				if !inSight(int64(x), int64(y)) {
+					continue
+				}
+				for _, shape := range shapes {
+					for _, element := range elements {
+						magic, err := op.newMagic([]int64{int64(x), int64(y)})
+						if err != nil {
+							t.Fatal(name, err)
+						}
+						magic.Shape = shape
+						magic.Element = element
+						source := decompileMagic(magic)
+						magics, err := Compile(source)
+						if err != nil {
+							t.Fatal(source, err)
+						}
+						assert.Equal(t, []domain.Magic{magic}, magics, source)
+						formatted, err := FormatSource(source)
+						assert.Nil(t, err, source)
+						assert.Equal(t, source, formatted, source)
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestDecompileCompiled ... magics compiled from timings and repeat compile back from their source as they are
+func TestDecompileCompiled(t *testing.T) {
+	for _, arg := range []string{
+		"(repeat 3 (gandr 1 0))",
+		"(repeat 2 (fire (line (gandr 2 0))))",
+		"(delay 2 (persist 3 (seiethr 1 2)))",
+		"(repeat 4 (delay 1 (cross (seiethr 0 3))))",
+		"(seq (repeat 2 (gandr 1 0)) (gandr 1 0) (persist 1 (gandr 0 1)))",
+		"(repeat 2 (seq (gandr 1 0) (gandr 0 1)))",
+		"(repeat 2 (repeat 2 (gandr 1 0)))",
+		"(repeat 2 (seq (gandr 1 0) (repeat 3 (persist 1 (gandr 2 0)))))",
+		"(seq (gandr 1 0) (repeat 3 (seq (fire (gandr 0 1)) (repeat 2 (gandr 1 1)))))",
+	} {
+		magics, err := Compile(arg)
+		if err != nil {
+			t.Fatal(arg, err)
+		}
+		source := DecompileAll(magics)
+		assert.Equal(t, arg, source, arg)
+		decompiled, err := Compile(source)
+		if err != nil {
+			t.Fatal(source, err)
+		}
+		assert.Equal(t, magics, decompiled, arg)
+	}
+
+	// magic of second iteration alone is not made by repeat, so its cost is not kept
+	magics, err := Compile("(repeat 2 (gandr 1 0))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "(gandr 1 0)", DecompileAll(magics[1:]))
+}
+
+func TestDecompileAll(t *testing.T) {
+	table := map[string]string{
+		"empty": "",
+		"single": "(gandr 1 2)",
+		"seq": "(seq (gandr 1 2) (seiethr 0 3))",
+		"seq of shapes": "(seq (line (gandr 1 2)) (seiethr 0 3))",
+		"seq of timings": "(seq (delay 2 (gandr 1 2)) (persist 3 (cone (seiethr 0 3))))",
+	}
+
+	for key, source := range table {
+		magics, err := Compile(source)
+		if source != "" && err != nil {
+			t.Fatal(key, err)
+		}
+		assert.Equal(t, source, DecompileAll(magics), key)
+	}
+}
@@ -0,0 +1,37 @@
+package compiler
+
+// variable ... what a name bound by let refers. point value uses 2 slots from slot
+type variable struct {
+	slot int64
+	typ  valueType
+}
+
+// environment ... scoped table of names bound by let. inner scope can see names of outer scope
+type environment struct {
+	values map[string]variable
+	outer  *environment
+}
+
+func newEnvironment(outer *environment) (env *environment) {
+	env = &environment{
+		values: map[string]variable{},
+		outer:  outer,
+	}
+	return
+}
+
+// define ... bind name to value in this scope. it shadows the same name of outer scope
+func (env *environment) define(name string, value variable) {
+	env.values[name] = value
+}
+
+// lookup ... search name from this scope to outer scopes
+func (env *environment) lookup(name string) (value variable, ok bool) {
+	for e := env; e != nil; e = e.outer {
+		value, ok = e.values[name]
+		if ok {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,65 @@
+package compiler
+
+import (
+	"domain"
+	"fmt"
+	"unicode/utf8"
+)
+
+// eof ... word of Error.Got when source ended before expected word
+const eof = "eof"
+
+// Error ... error found at a position of spell source
+type Error struct {
+	Pos domain.Position
+	// Expected ... what compiler expected at Pos
+	Expected string
+	// Got ... word found at Pos
+	Got string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("column %d: expect %s but got %s", e.Pos.Column+1, e.Expected, e.Got)
+}
+
+// Positioned ... error which points a span of spell source
+type Positioned interface {
+	error
+	Position() domain.Position
+	Width() int
+}
+
+// Position ... where the error is found in source
+func (e *Error) Position() domain.Position {
+	return e.Pos
+}
+
+// Width ... number of runes of the word which caused this error
+func (e *Error) Width() (width int) {
+	width = utf8.RuneCountInString(e.Got)
+	if e.Got == eof || width == 0 {
+		width = 1
+	}
+	return
+}
+
+// unexpected ... make error at head of tokens. if tokens is empty, error is eof
+func unexpected(tokens []domain.LexicalObject, expected string) (err *Error) {
+	err = &Error{Expected: expected, Got: eof}
+	if len(tokens) > 0 {
+		err.Pos = tokens[0].Pos
+		err.Got = tokens[0].Word
+	}
+	return
+}
+
+// endOf ... position just after the last token
+func endOf(tokens []domain.LexicalObject) (pos domain.Position) {
+	if len(tokens) <= 0 {
+		return
+	}
+	last := tokens[len(tokens)-1]
+	pos.Offset = last.Pos.Offset + len(last.Word)
+	pos.Column = last.Pos.Column + utf8.RuneCountInString(last.Word)
+	return
+}
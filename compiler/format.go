@@ -0,0 +1,185 @@
+package compiler
+
+import (
+	"domain"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// operatorWords ... source word of each operator except magic, builtin, shape and element whose word is its name
+var operatorWords = map[domain.DataLabel]string{
+	domain.OperatorAdd:          "+",
+	domain.OperatorSub:          "-",
+	domain.OperatorMul:          "*",
+	domain.OperatorDiv:          "/",
+	domain.OperatorLet:          "let",
+	domain.OperatorSeq:          "seq",
+	domain.OperatorIf:           "if",
+	domain.OperatorLess:         "<",
+	domain.OperatorLessEqual:    "<=",
+	domain.OperatorGreater:      ">",
+	domain.OperatorGreaterEqual: ">=",
+	domain.OperatorEqual:        "=",
+	domain.OperatorDefine:       "define",
+	domain.OperatorDelay:        "delay",
+	domain.OperatorPersist:      "persist",
+	domain.OperatorRepeat:       "repeat",
+}
+
+// Format ... make canonical source of ast made by parser. compiling the source makes the same magics as ast.
+// spell of several forms is formatted as seq of them
+func Format(ast *domain.Node) (source string, err error) {
+	if ast == nil || ast.Type != domain.Root {
+		err = fmt.Errorf("internal error: expected root")
+		return
+	}
+	if ast.Left == nil {
+		return
+	}
+	b := &strings.Builder{}
+	err = formatForm(b, ast.Left, ast.Right)
+	source = b.String()
+	return
+}
+
+// FormatSource ... normalize spell source
+func FormatSource(arg string) (source string, err error) {
+	tokens, err := lexicalAnalyze(arg)
+	if err != nil {
+		return
+	}
+	ast, err := parse(tokens)
+	if err != nil {
+		return
+	}
+	source, err = Format(ast)
+	return
+}
+
+// formatForm ... write (operator operands...)
+func formatForm(b *strings.Builder, operator, operands *domain.Node) (err error) {
+	if operator == nil || operator.Type != domain.Operator {
+		err = fmt.Errorf("internal error: expected operator")
+		return
+	}
+	word, ok := operatorWords[operator.Data.Label]
+	switch operator.Data.Label {
+	case domain.OperatorSpell, domain.OperatorBuiltin, domain.OperatorShape, domain.OperatorElement:
+		word, ok = operator.Data.Text, true
+	}
+	if !ok {
+		err = fmt.Errorf("internal error: unknown operator %s", operator.Data.Label)
+		return
+	}
+
+	b.WriteString("(")
+	b.WriteString(word)
+	switch operator.Data.Label {
+	case domain.OperatorLet:
+		err = formatLet(b, operands)
+	case domain.OperatorIf:
+		err = formatIf(b, operands)
+	case domain.OperatorDefine:
+		if operands == nil || operands.Type != domain.Binding {
+			err = fmt.Errorf("internal error: expected binding of define")
+			return
+		}
+		b.WriteString(" " + operands.Data.Text + " ")
+		err = formatAtom(b, operands.Left)
+	default:
+		var nodes []*domain.Node
+		nodes, err = getOperands(operands)
+		if err != nil {
+			return
+		}
+		for _, node := range nodes {
+			b.WriteString(" ")
+			if err = formatAtom(b, node); err != nil {
+				return
+			}
+		}
+	}
+	if err != nil {
+		return
+	}
+	b.WriteString(")")
+	return
+}
+
+// formatLet ... write ((name value)...) body of let
+func formatLet(b *strings.Builder, operands *domain.Node) (err error) {
+	nodes, err := getOperands(operands)
+	if err != nil {
+		return
+	}
+	if len(nodes) != 2 {
+		err = fmt.Errorf("internal error: let expects bindings and body")
+		return
+	}
+	bindings, err := getOperands(nodes[0])
+	if err != nil {
+		return
+	}
+
+	b.WriteString(" (")
+	for i, binding := range bindings {
+		if binding.Type != domain.Binding || binding.Left == nil {
+			err = fmt.Errorf("internal error: unexpected type %s at bindings of let", binding.Type)
+			return
+		}
+		if i > 0 {
+			b.WriteString(" ")
+		}
+		b.WriteString("(")
+		b.WriteString(binding.Data.Text)
+		b.WriteString(" ")
+		if err = formatAtom(b, binding.Left); err != nil {
+			return
+		}
+		b.WriteString(")")
+	}
+	b.WriteString(") ")
+	err = formatAtom(b, nodes[1])
+	return
+}
+
+// formatIf ... write cond then else of if
+func formatIf(b *strings.Builder, conditional *domain.Node) (err error) {
+	if conditional == nil || conditional.Type != domain.Conditional || conditional.Right == nil || conditional.Right.Type != domain.Branch {
+		err = fmt.Errorf("internal error: expected conditional")
+		return
+	}
+	for _, node := range []*domain.Node{conditional.Left, conditional.Right.Left, conditional.Right.Right} {
+		b.WriteString(" ")
+		if err = formatAtom(b, node); err != nil {
+			return
+		}
+	}
+	return
+}
+
+func formatAtom(b *strings.Builder, node *domain.Node) (err error) {
+	if node == nil {
+		err = fmt.Errorf("internal error: unexpected nil atom")
+		return
+	}
+	switch node.Type {
+	case domain.Literal:
+		switch node.Data.Label {
+		case domain.Number:
+			b.WriteString(strconv.FormatInt(node.Data.Number, 10))
+		case domain.String:
+			b.WriteString(quote(node.Data.Text))
+		default:
+			err = fmt.Errorf("internal error: unexpected literal %s", node.Data.Label)
+		}
+	case domain.Variable:
+		b.WriteString(node.Data.Text)
+	case domain.Expression:
+		err = formatForm(b, node.Left, node.Right)
+	default:
+		err = fmt.Errorf("internal error: unexpected type %s at atom", node.Type)
+	}
+	return
+}
@@ -0,0 +1,86 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/anaseto/gruid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFormat(t *testing.T) {
+	type TestItem struct {
+		Arg string
+		Expected string
+	}
+	table := map[string]TestItem{
+		"spaces": {
+			Arg: "  ( gandr\t1   2 )  ",
+			Expected: "(gandr 1 2)",
+		},
+		"arithmetic": {
+			Arg: "(seiethr (* 2 (- 3 1)) (-  2))",
+			Expected: "(seiethr (* 2 (- 3 1)) (- 2))",
+		},
+		"negative literal": {
+			Arg: "(gandr -1 (/ 7 -2))",
+			Expected: "(gandr -1 (/ 7 -2))",
+		},
+		"let": {
+			Arg: "(let ((d 2)(dx (* d 2))) (let ((d 1)) (seiethr dx (- d))))",
+			Expected: "(let ((d 2) (dx (* d 2))) (let ((d 1)) (seiethr dx (- d))))",
+		},
+		"several forms": {
+			Arg: "(gandr 1 0)\n(seiethr 3 0)",
+			Expected: "(seq (gandr 1 0) (seiethr 3 0))",
+		},
+		"shape": {
+			Arg: "(line  (seq (gandr 1 2)(cone (seiethr 3 0))))",
+			Expected: "(line (seq (gandr 1 2) (cone (seiethr 3 0))))",
+		},
+		"timing": {
+			Arg: "(delay (+ 1 1)  (persist 2 (gandr 1 2)))",
+			Expected: "(delay (+ 1 1) (persist 2 (gandr 1 2)))",
+		},
+		"repeat": {
+			Arg: "(repeat  3 (gandr 1 2))",
+			Expected: "(repeat 3 (gandr 1 2))",
+		},
+		"if and builtin": {
+			Arg: "(if (>= (enemy-count-in 4) 3) (seiethr 0 0) (gandr (nearest-enemy)))",
+			Expected: "(if (>= (enemy-count-in 4) 3) (seiethr 0 0) (gandr (nearest-enemy)))",
+		},
+		"string and comment": {
+			Arg: "; target by name\n(seq (gandr \"troll\") ; first\n (gandr \"a\\\\b\\\"\"))",
+			Expected: "(seq (gandr \"troll\") (gandr \"a\\\\b\\\"\"))",
+		},
+		"empty": {
+			Arg: "   ",
+			Expected: "",
+		},
+	}
+
+	w := testWorld{
+		caster: 1,
+		position: gruid.Point{X: 5, Y: 5},
+		hostiles: []gruid.Point{{X: 9, Y: 5}, {X: 5, Y: 3}},
+		named: map[string][]gruid.Point{"troll": {{X: 9, Y: 5}}, "a\\b\"": {{X: 5, Y: 3}}},
+	}
+	for key, item := range table {
+		source, err := FormatSource(item.Arg)
+		if err != nil {
+			t.Fatal(key, err)
+		}
+		assert.Equal(t, item.Expected, source, key)
+
+		// canonical source is a fixed point
+		again, err := FormatSource(source)
+		assert.Nil(t, err, key)
+		assert.Equal(t, source, again, key)
+
+		// round trip keeps meaning
+		expected, expectedErr := CompileWith(item.Arg, w)
+		magics, err := CompileWith(source, w)
+		assert.Equal(t, expectedErr, err, key)
+		assert.Equal(t, expected, magics, key)
+	}
+}
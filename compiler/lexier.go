@@ -2,27 +2,83 @@
 package compiler
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"unicode"
 	"unicode/utf8"
 
 	"domain"
 )
+// keyWords ... words reserved by language. magic operators and builtins are in their own registries
+var keyWords = map[string]domain.LexicalObjectLabel{
+	"let":    domain.KeyWordLet,
+	"seq":    domain.KeyWordSeq,
+	"if":     domain.KeyWordIf,
+	"define": domain.KeyWordDefine,
+	"circle": domain.KeyWordShape,
+	"line":   domain.KeyWordShape,
+	"cone":   domain.KeyWordShape,
+	"cross":  domain.KeyWordShape,
+
+	"physical":  domain.KeyWordElement,
+	"fire":      domain.KeyWordElement,
+	"frost":     domain.KeyWordElement,
+	"lightning": domain.KeyWordElement,
+
+	"delay":   domain.KeyWordDelay,
+	"persist": domain.KeyWordPersist,
+	"repeat":  domain.KeyWordRepeat,
+}
+
+// shapes ... shape of area named by each shape keyword
+var shapes = map[string]domain.MagicShape{
+	"circle": domain.ShapeCircle,
+	"line":   domain.ShapeLine,
+	"cone":   domain.ShapeCone,
+	"cross":  domain.ShapeCross,
+}
+
+// elements ... element named by each element keyword
+var elements = map[string]domain.Element{
+	"physical":  domain.ElementPhysical,
+	"fire":      domain.ElementFire,
+	"frost":     domain.ElementFrost,
+	"lightning": domain.ElementLightning,
+}
+
 func lexicalAnalyze(arg string) (tokens []domain.LexicalObject, err error) {	
 	input := arg
 	for len(input) > 0 {
 		input = skipWhiteSpace(input)
+		if len(input) <= 0 {
+			break
+		}
+		pos := positionOf(arg, input)
 		w, rest := consumeWord(input)
 		lo, err := getLexicalObjectFromWord(w)
 		if err != nil {
-			return nil, err
+			expected := "word"
+			if strings.HasPrefix(w, `"`) {
+				expected = "string literal"
+			}
+			return nil, &Error{Pos: pos, Expected: expected, Got: w}
 		}
+		lo.Pos = pos
 		tokens = append(tokens, lo)
 		input = rest
 	}
 	return
 }
 
+// positionOf ... position of rest in source. rest must be a suffix of source
+func positionOf(source, rest string) (pos domain.Position) {
+	pos.Offset = len(source) - len(rest)
+	pos.Column = utf8.RuneCountInString(source[:pos.Offset])
+	return
+}
+
 
 // isWhiteSpace ... if head of rune is whitespace then returns true
 func isWhiteSpace(r rune) bool {
@@ -36,24 +92,32 @@ func isWhiteSpace(r rune) bool {
 
 func isPunctuator(r rune) bool {
 	switch r {
-	case '(', ')':
+	case '(', ')', ';':
 		return true
 	default:
 		return false
 	}
 }
 
-// skipWhiteSpace .. skip whiteSpace 
+// skipWhiteSpace .. skip whiteSpace and comments. comment begins with ; and ends at end of line
 func skipWhiteSpace(s string) string{
 	pos := 0
 	for len(s) > pos {
 		r, size := utf8.DecodeRuneInString(s[pos:])
+		if r == ';' {
+			end := strings.IndexByte(s[pos:], '\n')
+			if end < 0 {
+				return ""
+			}
+			pos += end
+			continue
+		}
 		if !isWhiteSpace(r) {
 			return s[pos:]
 		}
 		pos += size
 	}
-	return s 
+	return s[pos:]
 }
 
 // consumeWord ... split a word from string. this function expects string not begin with white space
@@ -69,6 +133,9 @@ func consumeWord (s string) (word, rest string) {
 		word = ")"
 		rest = s[size:]
 		return 
+	case '"':
+		word, rest = consumeString(s)
+		return
 	}
   
 	// word 
@@ -85,19 +152,100 @@ func consumeWord (s string) (word, rest string) {
 	return 
 }
 
+// consumeString ... split a quoted string from s which begins with ". if it is not closed, whole s is the word
+func consumeString(s string) (word, rest string) {
+	escaped := false
+	for i, r := range s {
+		switch {
+		case i == 0:
+		case escaped:
+			escaped = false
+		case r == '\\':
+			escaped = true
+		case r == '"':
+			word = s[:i+1]
+			rest = s[i+1:]
+			return
+		}
+	}
+	word = s
+	return
+}
+
+// unquote ... value of string literal. escapes are \", \\, \n and \t
+func unquote(w string) (s string, err error) {
+	if len(w) < 2 || w[0] != '"' || w[len(w)-1] != '"' {
+		err = errors.New("string literal is not closed")
+		return
+	}
+	b := strings.Builder{}
+	escaped := false
+	for _, r := range w[1 : len(w)-1] {
+		if !escaped {
+			if r == '\\' {
+				escaped = true
+				continue
+			}
+			b.WriteRune(r)
+			continue
+		}
+		escaped = false
+		switch r {
+		case '"', '\\':
+			b.WriteRune(r)
+		case 'n':
+			b.WriteRune('\n')
+		case 't':
+			b.WriteRune('\t')
+		default:
+			err = fmt.Errorf("unknown escape \\%c", r)
+			return
+		}
+	}
+	if escaped {
+		err = errors.New("string literal is not closed")
+		return
+	}
+	s = b.String()
+	return
+}
+
+// quote ... string literal whose value is s. it is inverse of unquote
+func quote(s string) string {
+	b := strings.Builder{}
+	b.WriteRune('"')
+	for _, r := range s {
+		switch r {
+		case '"', '\\':
+			b.WriteRune('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteRune(r)
+		}
+	}
+	b.WriteRune('"')
+	return b.String()
+}
+
 func getLexicalObjectFromWord(w string) (lo domain.LexicalObject, err error) {
 	lo.Label = domain.LabelNull
 	lo.Word = w 
+	// check string literal
+	if strings.HasPrefix(w, `"`) {
+		lo.Type = domain.StringLiteral
+		_, err = unquote(w)
+		return
+	}
+
 	// check keyword 
-	switch w {
-	case "gandr":
+	if label, ok := keyWords[w]; ok {
 		lo.Type = domain.KeyWord
-		lo.Label = domain.KeyWordGandr
-		return 
-	case "seiethr":
-		lo.Type = domain.KeyWord
-		lo.Label = domain.KeyWordSeiethr
-		return 
+		lo.Label = label
+		return
 	}
 
 	// check symbol 
@@ -109,7 +257,63 @@ func getLexicalObjectFromWord(w string) (lo domain.LexicalObject, err error) {
 	case ")":
 		lo.Type = domain.Symbol
 		lo.Label = domain.SymbolParenthesisClose
-		return 
+		return
+	case "+":
+		lo.Type = domain.Symbol
+		lo.Label = domain.SymbolPlus
+		return
+	case "-":
+		lo.Type = domain.Symbol
+		lo.Label = domain.SymbolMinus
+		return
+	case "*":
+		lo.Type = domain.Symbol
+		lo.Label = domain.SymbolAsterisk
+		return
+	case "/":
+		lo.Type = domain.Symbol
+		lo.Label = domain.SymbolSlash
+		return
+	case "<":
+		lo.Type = domain.Symbol
+		lo.Label = domain.SymbolLess
+		return
+	case "<=":
+		lo.Type = domain.Symbol
+		lo.Label = domain.SymbolLessEqual
+		return
+	case ">":
+		lo.Type = domain.Symbol
+		lo.Label = domain.SymbolGreater
+		return
+	case ">=":
+		lo.Type = domain.Symbol
+		lo.Label = domain.SymbolGreaterEqual
+		return
+	case "=":
+		lo.Type = domain.Symbol
+		lo.Label = domain.SymbolEqual
+		return
+	}
+
+	// check builtin function
+	if _, ok := builtins[w]; ok {
+		lo.Type = domain.KeyWord
+		lo.Label = domain.KeyWordBuiltin
+		return
+	}
+
+	// check magic operator
+	if _, ok := operators[w]; ok {
+		lo.Type = domain.KeyWord
+		lo.Label = domain.KeyWordSpell
+		return
+	}
+
+	// check identifier
+	if isIdentifier(w) {
+		lo.Type = domain.Identifier
+		return
 	}
 
 	// check number literal
@@ -119,4 +323,17 @@ func getLexicalObjectFromWord(w string) (lo domain.LexicalObject, err error) {
 	}
 	lo.Type = domain.NumberLiteral
 	return 
+}
+
+// isIdentifier ... identifier begins with a letter and continues with letters, digits, - or _
+func isIdentifier(w string) bool {
+	for i, r := range w {
+		switch {
+		case unicode.IsLetter(r):
+		case i > 0 && (unicode.IsDigit(r) || r == '-' || r == '_'):
+		default:
+			return false
+		}
+	}
+	return len(w) > 0
 }
\ No newline at end of file
@@ -38,6 +38,8 @@ func TestSkipWhiteSpace(t *testing.T) {
 	}
 	table := map[string]TestItem {
 		"white head one" : {" 12 )", "12 )"},
+		"comment" : {"; a (b)\n 1)", "1)"},
+		"comment at end" : {"; a (b)", ""},
 		"many white space" : {"  	12)", "12)"},
 		"no white head" : {"1)", "1)"},
 	}
@@ -62,19 +64,105 @@ func TestLexicalAnalyze(t *testing.T) {
 			IsSuccess: true,
 			ExpectLen: 5,
 			ExpectObjects: []domain.LexicalObject{
-				{Type: domain.Symbol, Label: domain.SymbolParenthesisOpen, Word: "("},
-				{Type: domain.KeyWord, Label: domain.KeyWordGandr, Word: "gandr"},
-				{Type: domain.NumberLiteral, Label: domain.LabelNull, Word: "1"},
-				{Type:domain.NumberLiteral, Label: domain.LabelNull, Word: "2"},
-				{Type: domain.Symbol, Label: domain.SymbolParenthesisClose, Word: ")"},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisOpen, Word: "(", Pos: domain.Position{Offset: 0, Column: 0}},
+				{Type: domain.KeyWord, Label: domain.KeyWordSpell, Word: "gandr", Pos: domain.Position{Offset: 1, Column: 1}},
+				{Type: domain.NumberLiteral, Label: domain.LabelNull, Word: "1", Pos: domain.Position{Offset: 7, Column: 7}},
+				{Type:domain.NumberLiteral, Label: domain.LabelNull, Word: "2", Pos: domain.Position{Offset: 9, Column: 9}},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisClose, Word: ")", Pos: domain.Position{Offset: 10, Column: 10}},
+			},
+		},
+		"arithmetic": {
+			Arg: "(+ -1 (* 2 3))",
+			IsSuccess: true,
+			ExpectLen: 9,
+			ExpectObjects: []domain.LexicalObject{
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisOpen, Word: "(", Pos: domain.Position{Offset: 0, Column: 0}},
+				{Type: domain.Symbol, Label: domain.SymbolPlus, Word: "+", Pos: domain.Position{Offset: 1, Column: 1}},
+				{Type: domain.NumberLiteral, Label: domain.LabelNull, Word: "-1", Pos: domain.Position{Offset: 3, Column: 3}},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisOpen, Word: "(", Pos: domain.Position{Offset: 6, Column: 6}},
+				{Type: domain.Symbol, Label: domain.SymbolAsterisk, Word: "*", Pos: domain.Position{Offset: 7, Column: 7}},
+				{Type: domain.NumberLiteral, Label: domain.LabelNull, Word: "2", Pos: domain.Position{Offset: 9, Column: 9}},
+				{Type: domain.NumberLiteral, Label: domain.LabelNull, Word: "3", Pos: domain.Position{Offset: 11, Column: 11}},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisClose, Word: ")", Pos: domain.Position{Offset: 12, Column: 12}},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisClose, Word: ")", Pos: domain.Position{Offset: 13, Column: 13}},
+			},
+		},
+		"identifier": {
+			Arg: "(let ((dx 3)) dx)",
+			IsSuccess: true,
+			ExpectLen: 10,
+			ExpectObjects: []domain.LexicalObject{
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisOpen, Word: "(", Pos: domain.Position{Offset: 0, Column: 0}},
+				{Type: domain.KeyWord, Label: domain.KeyWordLet, Word: "let", Pos: domain.Position{Offset: 1, Column: 1}},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisOpen, Word: "(", Pos: domain.Position{Offset: 5, Column: 5}},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisOpen, Word: "(", Pos: domain.Position{Offset: 6, Column: 6}},
+				{Type: domain.Identifier, Label: domain.LabelNull, Word: "dx", Pos: domain.Position{Offset: 7, Column: 7}},
+				{Type: domain.NumberLiteral, Label: domain.LabelNull, Word: "3", Pos: domain.Position{Offset: 10, Column: 10}},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisClose, Word: ")", Pos: domain.Position{Offset: 11, Column: 11}},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisClose, Word: ")", Pos: domain.Position{Offset: 12, Column: 12}},
+				{Type: domain.Identifier, Label: domain.LabelNull, Word: "dx", Pos: domain.Position{Offset: 14, Column: 14}},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisClose, Word: ")", Pos: domain.Position{Offset: 16, Column: 16}},
+			},
+		},
+		"string": {
+			Arg: `(gandr "old troll")`,
+			IsSuccess: true,
+			ExpectLen: 4,
+			ExpectObjects: []domain.LexicalObject{
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisOpen, Word: "(", Pos: domain.Position{Offset: 0, Column: 0}},
+				{Type: domain.KeyWord, Label: domain.KeyWordSpell, Word: "gandr", Pos: domain.Position{Offset: 1, Column: 1}},
+				{Type: domain.StringLiteral, Label: domain.LabelNull, Word: `"old troll"`, Pos: domain.Position{Offset: 7, Column: 7}},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisClose, Word: ")", Pos: domain.Position{Offset: 18, Column: 18}},
+			},
+		},
+		"string with escapes and parenthesis": {
+			Arg: `("a\"(b)\\")`,
+			IsSuccess: true,
+			ExpectLen: 3,
+			ExpectObjects: []domain.LexicalObject{
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisOpen, Word: "(", Pos: domain.Position{Offset: 0, Column: 0}},
+				{Type: domain.StringLiteral, Label: domain.LabelNull, Word: `"a\"(b)\\"`, Pos: domain.Position{Offset: 1, Column: 1}},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisClose, Word: ")", Pos: domain.Position{Offset: 11, Column: 11}},
+			},
+		},
+		"comments": {
+			Arg: "; fire ball\n(seiethr 1;x\n 2) ; end",
+			IsSuccess: true,
+			ExpectLen: 5,
+			ExpectObjects: []domain.LexicalObject{
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisOpen, Word: "(", Pos: domain.Position{Offset: 12, Column: 12}},
+				{Type: domain.KeyWord, Label: domain.KeyWordSpell, Word: "seiethr", Pos: domain.Position{Offset: 13, Column: 13}},
+				{Type: domain.NumberLiteral, Label: domain.LabelNull, Word: "1", Pos: domain.Position{Offset: 21, Column: 21}},
+				{Type: domain.NumberLiteral, Label: domain.LabelNull, Word: "2", Pos: domain.Position{Offset: 26, Column: 26}},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisClose, Word: ")", Pos: domain.Position{Offset: 27, Column: 27}},
+			},
+		},
+		"semicolon in string": {
+			Arg: `"a;b"`,
+			IsSuccess: true,
+			ExpectLen: 1,
+			ExpectObjects: []domain.LexicalObject{
+				{Type: domain.StringLiteral, Label: domain.LabelNull, Word: `"a;b"`, Pos: domain.Position{Offset: 0, Column: 0}},
 			},
 		},
 		"error": {
-			Arg: "(gundr 1 2)",
+			Arg: "(g@ndr 1 2)",
 			IsSuccess: false,
 			ExpectLen: 0,
 			ExpectObjects: nil,
 		},
+		"error: unclosed string": {
+			Arg: `(gandr "troll)`,
+			IsSuccess: false,
+		},
+		"error: escaped last quote": {
+			Arg: `(gandr "troll\")`,
+			IsSuccess: false,
+		},
+		"error: unknown escape": {
+			Arg: `(gandr "tr\oll")`,
+			IsSuccess: false,
+		},
 	}
 	for key, item := range table {
 		tokens, err := lexicalAnalyze(item.Arg)
@@ -91,4 +179,21 @@ func TestLexicalAnalyze(t *testing.T) {
 		}
 	}
 
-}
\ No newline at end of file
+}
+
+func TestQuote(t *testing.T) {
+	table := map[string]string{
+		"plain": "troll",
+		"escapes": "a\"b\\c\nd\te",
+		"multibyte": "トロル",
+		"empty": "",
+	}
+	for key, item := range table {
+		s, err := unquote(quote(item))
+		assert.Nil(t, err, key)
+		assert.Equal(t, item, s, key)
+	}
+	s, err := unquote(`"a\"b\n"`)
+	assert.Nil(t, err)
+	assert.Equal(t, "a\"b\n", s)
+}
@@ -0,0 +1,194 @@
+package compiler
+
+import (
+	"bytes"
+	"domain"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// operatorsData ... magic operators which are loaded at start
+//
+//go:embed operators.json
+var operatorsData []byte
+
+// Operator ... magic operator of spell language. lexer, parser and generator consult registry of them
+type Operator struct {
+	// Name ... keyword of the operator
+	Name string `json:"name"`
+	// Params ... kinds of operands in order. see paramTypes
+	Params []string `json:"params"`
+	// Amount ... mana cost
+	Amount int `json:"amount"`
+	// Power ... damage to each entity in affected area
+	Power int `json:"power"`
+	// Radius ... radius of affected area
+	Radius int `json:"radius"`
+	// Effect ... name of domain.MagicEffect
+	Effect string `json:"effect"`
+}
+
+const (
+	// paramTarget ... point or x and y which magic targets
+	paramTarget = "target"
+)
+
+// paramTypes ... type of each kind of operands
+var paramTypes = map[string]valueType{
+	paramTarget: typePoint,
+}
+
+var effects = map[string]domain.MagicEffect{
+	domain.EffectDamage.String(): domain.EffectDamage,
+}
+
+// operators ... registry of magic operators. key is name
+var operators = defaultOperators()
+
+func defaultOperators() (registry map[string]Operator) {
+	registry = map[string]Operator{}
+	if err := loadOperators(registry, bytes.NewReader(operatorsData)); err != nil {
+		panic(err)
+	}
+	return
+}
+
+// loadOperators ... add operators of json array to registry. an operator replaces the one of the same name.
+// nothing is added if any of them is invalid
+func loadOperators(registry map[string]Operator, r io.Reader) (err error) {
+	loaded := []Operator{}
+	if err = json.NewDecoder(r).Decode(&loaded); err != nil {
+		err = fmt.Errorf("invalid operators: %w", err)
+		return
+	}
+	for _, op := range loaded {
+		if err = op.validate(); err != nil {
+			return
+		}
+	}
+	for _, op := range loaded {
+		registry[op.Name] = op
+	}
+	return
+}
+
+// validate ... check operator can be a keyword and its parameters are known
+func (op Operator) validate() (err error) {
+	if !isIdentifier(op.Name) {
+		err = fmt.Errorf("invalid operator %q: name must be an identifier", op.Name)
+		return
+	}
+	_, isKeyWord := keyWords[op.Name]
+	_, isBuiltin := builtins[op.Name]
+	if isKeyWord || isBuiltin {
+		err = fmt.Errorf("invalid operator %q: name is reserved", op.Name)
+		return
+	}
+	targets := 0
+	seen := map[string]bool{}
+	for _, p := range op.Params {
+		if _, ok := paramTypes[p]; !ok {
+			err = fmt.Errorf("invalid operator %q: unknown parameter %q", op.Name, p)
+			return
+		}
+		if seen[p] {
+			err = fmt.Errorf("invalid operator %q: duplicated parameter %q", op.Name, p)
+			return
+		}
+		seen[p] = true
+		if p == paramTarget {
+			targets++
+		}
+	}
+	if targets != 1 {
+		err = fmt.Errorf("invalid operator %q: needs a target parameter", op.Name)
+		return
+	}
+	if op.Amount < 0 || op.Power < 0 || op.Radius < 0 {
+		err = fmt.Errorf("invalid operator %q: negative amount, power or radius", op.Name)
+		return
+	}
+	if _, ok := effects[op.Effect]; !ok {
+		err = fmt.Errorf("invalid operator %q: unknown effect %q", op.Name, op.Effect)
+		return
+	}
+	return
+}
+
+// matchParams ... check types of operands fit parameters. target accepts a point or 2 numbers.
+// name of entity is already converted to point
+func (op Operator) matchParams(types []valueType) (ok bool) {
+	for _, p := range op.Params {
+		switch {
+		case p == paramTarget && len(types) >= 1 && types[0] == typePoint:
+			types = types[1:]
+		case p == paramTarget && len(types) >= 2 && types[0] == typeNumber && types[1] == typeNumber:
+			types = types[2:]
+		default:
+			return
+		}
+	}
+	ok = len(types) == 0
+	return
+}
+
+// usage ... describe operands of operator for error message
+func (op Operator) usage() (s string) {
+	for i, p := range op.Params {
+		if i > 0 {
+			s += ", "
+		}
+		switch p {
+		case paramTarget:
+			s += "point, 2 numbers or name"
+		}
+	}
+	return
+}
+
+// newMagic ... make magic of operator from operand values in push order
+func (op Operator) newMagic(args []int64) (magic domain.Magic, err error) {
+	magic = domain.Magic{
+		Amount: op.Amount,
+		Damage: op.Power,
+		Effect: effects[op.Effect],
+		Radius: op.Radius,
+		Name:   op.Name,
+	}
+	for _, p := range op.Params {
+		switch p {
+		case paramTarget:
+			if !inSight(args[0], args[1]) {
+				err = fmt.Errorf("runtime error: target (%d, %d) of %s is out of sight", args[0], args[1], op.Name)
+				return
+			}
+			magic.Target.X, magic.Target.Y = int(args[0]), int(args[1])
+			args = args[2:]
+		}
+	}
+	return
+}
+
+// inSight ... target (x, y) is within domain.MaxLOS in manhattan distance from caster. it never overflows
+func inSight(x, y int64) bool {
+	if x < -domain.MaxLOS || x > domain.MaxLOS || y < -domain.MaxLOS || y > domain.MaxLOS {
+		return false
+	}
+	if x < 0 {
+		x = -x
+	}
+	if y < 0 {
+		y = -y
+	}
+	return x+y <= domain.MaxLOS
+}
+
+// argWidth ... number of stack values which magic of operator pops
+func (op Operator) argWidth() (width int) {
+	for _, p := range op.Params {
+		width += paramTypes[p].width()
+	}
+	return
+}
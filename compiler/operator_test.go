@@ -0,0 +1,118 @@
+package compiler
+
+import (
+	"domain"
+	"strings"
+	"testing"
+
+	"github.com/anaseto/gruid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDefaultOperators(t *testing.T) {
+	type TestItem struct {
+		Arg string
+		IsSuccess bool
+		ExpectedMagics []domain.Magic
+	}
+	table := map[string]TestItem{
+		"missing operand": {
+			Arg: "(gandr 2)",
+			IsSuccess: false,
+		},
+		"too many operands": {
+			Arg: "(gandr 2 0 1)",
+			IsSuccess: false,
+		},
+		"default radius": {
+			Arg: "(seiethr 0 1)",
+			IsSuccess: true,
+			ExpectedMagics: []domain.Magic{{Amount: 10, Damage: 10, Target: gruid.Point{X: 0, Y: 1}, Radius: 3, Name: "seiethr"}},
+		},
+	}
+
+	for key, item := range table {
+		magics, err := Compile(item.Arg)
+		if !item.IsSuccess {
+			assert.NotNil(t, err, key)
+			continue
+		}
+		if err != nil {
+			t.Fatal(key, err)
+		}
+		assert.Equal(t, item.ExpectedMagics, magics, key)
+	}
+}
+
+func TestLoadOperators(t *testing.T) {
+	registry := map[string]Operator{}
+	for name, op := range operators {
+		registry[name] = op
+	}
+
+	type TestItem struct {
+		Data string
+		IsSuccess bool
+	}
+	table := map[string]TestItem{
+		"new operator": {
+			Data: `[{"name": "isa", "params": ["target"], "amount": 3, "power": 2, "radius": 1, "effect": "damage"}]`,
+			IsSuccess: true,
+		},
+		"broken json": {
+			Data: `[{"name": "isa"`,
+		},
+		"reserved name": {
+			Data: `[{"name": "let", "params": ["target"], "effect": "damage"}]`,
+		},
+		"builtin name": {
+			Data: `[{"name": "nearest-enemy", "params": ["target"], "effect": "damage"}]`,
+		},
+		"not identifier": {
+			Data: `[{"name": "1a", "params": ["target"], "effect": "damage"}]`,
+		},
+		"no target": {
+			Data: `[{"name": "a", "params": [], "effect": "damage"}]`,
+		},
+		"unknown parameter": {
+			Data: `[{"name": "a", "params": ["target", "speed"], "effect": "damage"}]`,
+		},
+		"unknown effect": {
+			Data: `[{"name": "a", "params": ["target"], "effect": "teleport"}]`,
+		},
+		"negative cost": {
+			Data: `[{"name": "a", "params": ["target"], "amount": -1, "effect": "damage"}]`,
+		},
+		"one of them is invalid": {
+			Data: `[{"name": "b", "params": ["target"], "effect": "damage"}, {"name": "c", "params": [], "effect": "damage"}]`,
+		},
+	}
+
+	for key, item := range table {
+		err := loadOperators(registry, strings.NewReader(item.Data))
+		if item.IsSuccess {
+			assert.Nil(t, err, key)
+		} else {
+			assert.NotNil(t, err, key)
+		}
+	}
+	_, added := registry["b"]
+	assert.False(t, added, "invalid data adds nothing")
+	_, leaked := operators["isa"]
+	assert.False(t, leaked, "default registry is kept")
+
+	// new operator is a keyword without code changes. the registry is used only in this test
+	defaults := operators
+	operators = registry
+	t.Cleanup(func() {
+		operators = defaults
+	})
+	magics, err := Compile("(isa 1 (- 1))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []domain.Magic{{Amount: 3, Damage: 2, Target: gruid.Point{X: 1, Y: -1}, Radius: 1, Name: "isa"}}, magics)
+	source, err := FormatSource("(isa 1 (- 1))")
+	assert.Nil(t, err)
+	assert.Equal(t, "(isa 1 (- 1))", source)
+}
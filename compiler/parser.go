@@ -2,6 +2,7 @@ package compiler
 
 import (
 	"domain"
+	"errors"
 	"fmt"
 	"strconv"
 )
@@ -10,66 +11,125 @@ func parse(tokens []domain.LexicalObject) (root *domain.Node, err error) {
 	root = &domain.Node{
 		Type: domain.Root,
 	}
-	err = pair(tokens, root)
+	err = pair(tokens, root, newEnvironment(nil))
+	// parser does not know where source ends. eof is placed after the last token
+	var cerr *Error
+	if errors.As(err, &cerr) && cerr.Got == eof {
+		cerr.Pos = endOf(tokens)
+	}
 	return 
 }
 
-// pair ... parse pair
-func pair(tokens []domain.LexicalObject, ast *domain.Node) (err error) {
-	if len(tokens) <= 0 {
-		return 
-	}
-	tokens, ok := expect(tokens, "(")
-	if !ok {
-		err = fmt.Errorf("expect ( but got %s", tokens[0].Word)
-		return 
+// pair ... parse forms of spell. spell of several forms is same as (seq form...)
+func pair(tokens []domain.LexicalObject, ast *domain.Node, env *environment) (err error) {
+	forms := []*domain.Node{}
+	for len(tokens) > 0 {
+		if tokens[0].Word != "(" {
+			err = unexpected(tokens, "(")
+			return
+		}
+		var form *domain.Node
+		form, tokens, err = expression(tokens[1:], env)
+		if err != nil {
+			return
+		}
+		forms = append(forms, form)
 	}
 
-	for {
-		if len(tokens) <= 0 {
-			return 
+	switch len(forms) {
+	case 0:
+		return
+	case 1:
+		ast.Left = forms[0].Left
+		ast.Right = forms[0].Right
+	default:
+		ast.Left = &domain.Node{
+			Type: domain.Operator,
+			Data: domain.NodeData{Label: domain.OperatorSeq},
+			Pos: forms[0].Pos,
 		}
-		var head domain.LexicalObject
-		tokens, head = consume(tokens)
-		if isOperator(head) {
-			tokens, err = operator(head, tokens, ast)
-			if err != nil {
-				return 
-			}
-			var ok bool 
-			tokens, ok = expect(tokens, ")")
-			if !ok {
-				err = fmt.Errorf("expect ) but got %s", tokens[0].Word)
-				return
-			}
-			continue 
+		ast.Right = &domain.Node{
+			Type: domain.ArrayHead,
+			Right: &domain.Node{},
 		}
-
-		if head.Word == ")" {
-			err = pair(tokens, ast)
-			return 
+		item := ast.Right.Right
+		for _, form := range forms {
+			item.Type = domain.ArrayItem
+			item.Left = form
+			item.Right = &domain.Node{}
+			item = item.Right
 		}
-
-		err = fmt.Errorf("%s is not expected", head.Word)
-		return
+		item.Type = domain.ArrayTail
 	}
+	return
 }
 
 // operator ... parse operator witch is first element of array and operands of it. add then to ast
-func operator(operatorToken domain.LexicalObject, tokens []domain.LexicalObject, ast *domain.Node) (res []domain.LexicalObject, err error) {
+func operator(operatorToken domain.LexicalObject, tokens []domain.LexicalObject, ast *domain.Node, env *environment) (res []domain.LexicalObject, err error) {
 	leafOperator := &domain.Node{
 		Type: domain.Operator,
 		Data: domain.NodeData{},
+		Pos: operatorToken.Pos,
 	}
 	switch operatorToken.Label {
-	case domain.KeyWordGandr:
-		leafOperator.Data.Label = domain.OperatorGandr
-	case domain.KeyWordSeiethr:
-		leafOperator.Data.Label = domain.OperatorSeiethr
+	case domain.KeyWordSpell:
+		leafOperator.Data.Label = domain.OperatorSpell
+		leafOperator.Data.Text = operatorToken.Word
+	case domain.SymbolPlus:
+		leafOperator.Data.Label = domain.OperatorAdd
+	case domain.SymbolMinus:
+		leafOperator.Data.Label = domain.OperatorSub
+	case domain.SymbolAsterisk:
+		leafOperator.Data.Label = domain.OperatorMul
+	case domain.SymbolSlash:
+		leafOperator.Data.Label = domain.OperatorDiv
+	case domain.KeyWordLet:
+		leafOperator.Data.Label = domain.OperatorLet
+	case domain.KeyWordSeq:
+		leafOperator.Data.Label = domain.OperatorSeq
+	case domain.KeyWordBuiltin:
+		leafOperator.Data.Label = domain.OperatorBuiltin
+		leafOperator.Data.Text = operatorToken.Word
+	case domain.KeyWordIf:
+		leafOperator.Data.Label = domain.OperatorIf
+	case domain.KeyWordDefine:
+		leafOperator.Data.Label = domain.OperatorDefine
+	case domain.KeyWordShape:
+		leafOperator.Data.Label = domain.OperatorShape
+		leafOperator.Data.Text = operatorToken.Word
+	case domain.KeyWordElement:
+		leafOperator.Data.Label = domain.OperatorElement
+		leafOperator.Data.Text = operatorToken.Word
+	case domain.KeyWordDelay:
+		leafOperator.Data.Label = domain.OperatorDelay
+	case domain.KeyWordPersist:
+		leafOperator.Data.Label = domain.OperatorPersist
+	case domain.KeyWordRepeat:
+		leafOperator.Data.Label = domain.OperatorRepeat
+	case domain.SymbolLess:
+		leafOperator.Data.Label = domain.OperatorLess
+	case domain.SymbolLessEqual:
+		leafOperator.Data.Label = domain.OperatorLessEqual
+	case domain.SymbolGreater:
+		leafOperator.Data.Label = domain.OperatorGreater
+	case domain.SymbolGreaterEqual:
+		leafOperator.Data.Label = domain.OperatorGreaterEqual
+	case domain.SymbolEqual:
+		leafOperator.Data.Label = domain.OperatorEqual
 	}
 	
 	// parse operands
-	operands, res , err := list(tokens, true)
+	var operands *domain.Node
+	switch leafOperator.Data.Label {
+	case domain.OperatorLet:
+		operands, res, err = letOperands(tokens, env)
+	case domain.OperatorIf:
+		operands, res, err = ifOperands(tokens, env)
+	case domain.OperatorDefine:
+		operands, res, err = defineOperands(tokens, env)
+	default:
+		operands, res, err = list(tokens, true, env)
+	}
 	if err != nil {
 		return 
 	}
@@ -80,11 +140,11 @@ func operator(operatorToken domain.LexicalObject, tokens []domain.LexicalObject,
 }
 
 // list ... pase operand of operator 
-func list(tokens []domain.LexicalObject, isOperand bool) (ast *domain.Node, res []domain.LexicalObject, err error) {
+func list(tokens []domain.LexicalObject, isOperand bool, env *environment) (ast *domain.Node, res []domain.LexicalObject, err error) {
 	if !isOperand {
 		tokens, ok := expect(tokens, "(")
 		if !ok {
-			err = fmt.Errorf("expect ( but got %s", tokens[0].Word)
+			err = unexpected(tokens, "(")
 			return 
 		}
 	}
@@ -93,13 +153,13 @@ func list(tokens []domain.LexicalObject, isOperand bool) (ast *domain.Node, res
 		Type: domain.ArrayHead,
 		Right: &domain.Node{},
 	}
-	res, err = listElem(tokens, ast.Right)
+	res, err = listElem(tokens, ast.Right, env)
 	return 
 }
 
-func listElem(tokens []domain.LexicalObject, ast *domain.Node) (res[]domain.LexicalObject, err error) {
+func listElem(tokens []domain.LexicalObject, ast *domain.Node, env *environment) (res[]domain.LexicalObject, err error) {
 	if len(tokens) <= 0 {
-		err = fmt.Errorf("unexpected eof at list")
+		err = unexpected(tokens, ")")
 		return 
 	}
 
@@ -107,26 +167,32 @@ func listElem(tokens []domain.LexicalObject, ast *domain.Node) (res[]domain.Lexi
 	ast.Type = domain.ArrayItem
 	if tokens[0].Word == ")" {
 		ast.Type = domain.ArrayTail
+		res = tokens
 		return 
 	}
 
 	ast.Right = &domain.Node{}	
-	left, tokens, err := atom(tokens)
+	left, tokens, err := atom(tokens, env)
 	if err != nil {
 		return 
 	}
 	ast.Left = left
 	
-	res, err = listElem(tokens, ast.Right)
+	res, err = listElem(tokens, ast.Right, env)
 	return 
 }
 
 // atom ... parse atom, primary lexeme of this language. return leaf node which represents the atom 
-func atom(tokens []domain.LexicalObject) (leaf *domain.Node, res []domain.LexicalObject, err error) {
+func atom(tokens []domain.LexicalObject, env *environment) (leaf *domain.Node, res []domain.LexicalObject, err error) {
+	if len(tokens) <= 0 {
+		err = unexpected(tokens, "atom")
+		return
+	}
 	res, head := consume(tokens)
 	leaf = &domain.Node{
 		Type: domain.Literal,
 		Data: domain.NodeData{},
+		Pos: head.Pos,
 	}
 	switch head.Type {
 	case domain.NumberLiteral:
@@ -139,13 +205,196 @@ func atom(tokens []domain.LexicalObject) (leaf *domain.Node, res []domain.Lexica
 			return 
 		}
 		leaf.Data.Number = number
+	case domain.StringLiteral:
+		leaf.Data.Label = domain.String
+
+		var text string
+		text, err = unquote(head.Word)
+		if err != nil {
+			err = &Error{Pos: head.Pos, Expected: "string literal", Got: head.Word}
+			return
+		}
+		leaf.Data.Text = text
+	case domain.Symbol:
+		if head.Label != domain.SymbolParenthesisOpen {
+			err = &Error{Pos: head.Pos, Expected: "atom", Got: head.Word}
+			return
+		}
+		leaf, res, err = expression(res, env)
+	case domain.Identifier:
+		if _, ok := env.lookup(head.Word); !ok {
+			err = &Error{Pos: head.Pos, Expected: "defined name", Got: head.Word}
+			return
+		}
+		leaf.Type = domain.Variable
+		leaf.Data.Label = domain.Name
+		leaf.Data.Text = head.Word
 	default:
-		err = fmt.Errorf("%s is not atom of expression", head.Word)
+		err = &Error{Pos: head.Pos, Expected: "atom", Got: head.Word}
 		return 
 	}
 	return 
 }
 
+// expression ... parse nested expression after (. return node which has operator at left and operands at right
+func expression(tokens []domain.LexicalObject, env *environment) (node *domain.Node, res []domain.LexicalObject, err error) {
+	if len(tokens) <= 0 || !isOperator(tokens[0]) {
+		err = unexpected(tokens, "operator")
+		return
+	}
+	res, head := consume(tokens)
+
+	node = &domain.Node{
+		Type: domain.Expression,
+		Pos: head.Pos,
+	}
+	res, err = operator(head, res, node, env)
+	if err != nil {
+		return
+	}
+	// operands end with ) which is left by listElem
+	res, _ = expect(res, ")")
+	return
+}
+
+// letOperands ... parse ((name value) ...) body of let. returns list of bindings and body.
+// each binding can refer names bound before it and body can refer all of them
+func letOperands(tokens []domain.LexicalObject, env *environment) (ast *domain.Node, res []domain.LexicalObject, err error) {
+	if len(tokens) <= 0 || tokens[0].Word != "(" {
+		err = unexpected(tokens, "( of bindings")
+		return
+	}
+	res, _ = consume(tokens)
+
+	scope := newEnvironment(env)
+	bindings := &domain.Node{
+		Type:  domain.ArrayHead,
+		Right: &domain.Node{},
+	}
+	item := bindings.Right
+	for {
+		if len(res) <= 0 || (res[0].Word != "(" && res[0].Word != ")") {
+			err = unexpected(res, "(")
+			return
+		}
+		var head domain.LexicalObject
+		res, head = consume(res)
+		if head.Word == ")" {
+			item.Type = domain.ArrayTail
+			break
+		}
+
+		if len(res) <= 0 || res[0].Type != domain.Identifier {
+			err = unexpected(res, "name")
+			return
+		}
+		var name domain.LexicalObject
+		res, name = consume(res)
+		var value *domain.Node
+		value, res, err = atom(res, scope)
+		if err != nil {
+			return
+		}
+		if len(res) <= 0 || res[0].Word != ")" {
+			err = unexpected(res, ")")
+			return
+		}
+		res, _ = consume(res)
+		scope.define(name.Word, variable{})
+
+		item.Type = domain.ArrayItem
+		item.Left = &domain.Node{
+			Type: domain.Binding,
+			Data: domain.NodeData{Label: domain.Name, Text: name.Word},
+			Left: value,
+			Pos: name.Pos,
+		}
+		item.Right = &domain.Node{}
+		item = item.Right
+	}
+
+	body, res, err := atom(res, scope)
+	if err != nil {
+		return
+	}
+	if len(res) <= 0 || res[0].Word != ")" {
+		err = unexpected(res, ")")
+		return
+	}
+
+	ast = &domain.Node{
+		Type: domain.ArrayHead,
+		Right: &domain.Node{
+			Type: domain.ArrayItem,
+			Left: bindings,
+			Right: &domain.Node{
+				Type: domain.ArrayItem,
+				Left: body,
+				Right: &domain.Node{
+					Type: domain.ArrayTail,
+				},
+			},
+		},
+	}
+	return
+}
+
+// ifOperands ... parse cond then else of if. returns Conditional node
+func ifOperands(tokens []domain.LexicalObject, env *environment) (ast *domain.Node, res []domain.LexicalObject, err error) {
+	ast = &domain.Node{
+		Type: domain.Conditional,
+		Right: &domain.Node{Type: domain.Branch},
+	}
+	if len(tokens) > 0 {
+		ast.Pos = tokens[0].Pos
+	}
+	ast.Left, res, err = atom(tokens, env)
+	if err != nil {
+		return
+	}
+	ast.Right.Left, res, err = atom(res, env)
+	if err != nil {
+		return
+	}
+	ast.Right.Right, res, err = atom(res, env)
+	if err != nil {
+		return
+	}
+	if len(res) <= 0 || res[0].Word != ")" {
+		err = unexpected(res, ")")
+		return
+	}
+	return
+}
+
+// defineOperands ... parse name and spell of define. returns Binding of them
+func defineOperands(tokens []domain.LexicalObject, env *environment) (ast *domain.Node, res []domain.LexicalObject, err error) {
+	if len(tokens) <= 0 || tokens[0].Type != domain.Identifier {
+		err = unexpected(tokens, "name")
+		return
+	}
+	res, name := consume(tokens)
+	if len(res) <= 0 || res[0].Word != "(" {
+		err = unexpected(res, "(")
+		return
+	}
+	body, res, err := atom(res, env)
+	if err != nil {
+		return
+	}
+	if len(res) <= 0 || res[0].Word != ")" {
+		err = unexpected(res, ")")
+		return
+	}
+	ast = &domain.Node{
+		Type: domain.Binding,
+		Data: domain.NodeData{Label: domain.Name, Text: name.Word},
+		Left: body,
+		Pos: name.Pos,
+	}
+	return
+}
+
 // expect ... check head token is an expect object if it is ok then consume tokens
 func expect(tokens []domain.LexicalObject, expectedWord string ) (res []domain.LexicalObject, ok bool) {
 	res = tokens 
@@ -177,9 +426,15 @@ func consume(tokens []domain.LexicalObject) (res []domain.LexicalObject, head do
 // isOperator ... check token is operator
 func isOperator(token domain.LexicalObject) bool {
 	switch token.Label {
-	case domain.KeyWordGandr:
-		return true 
-	case domain.KeyWordSeiethr:
+	case domain.KeyWordSpell:
+		return true
+	case domain.SymbolPlus, domain.SymbolMinus, domain.SymbolAsterisk, domain.SymbolSlash:
+		return true
+	case domain.KeyWordLet, domain.KeyWordSeq, domain.KeyWordBuiltin, domain.KeyWordIf, domain.KeyWordDefine, domain.KeyWordShape, domain.KeyWordElement:
+		return true
+	case domain.KeyWordDelay, domain.KeyWordPersist, domain.KeyWordRepeat:
+		return true
+	case domain.SymbolLess, domain.SymbolLessEqual, domain.SymbolGreater, domain.SymbolGreaterEqual, domain.SymbolEqual:
 		return true
 	default:
 		return false 
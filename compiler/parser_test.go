@@ -32,7 +32,7 @@ func TestParser(t *testing.T) {
 		"success: (gandr 1 2)": {
 			Tokens: []domain.LexicalObject{
 				{Type: domain.Symbol, Label: domain.SymbolParenthesisOpen, Word: "("},
-				{Type: domain.KeyWord, Label: domain.KeyWordGandr, Word: "gandr"},
+				{Type: domain.KeyWord, Label: domain.KeyWordSpell, Word: "gandr"},
 				{Type: domain.NumberLiteral, Label: domain.LabelNull, Word: "1"},
 				{Type:domain.NumberLiteral, Label: domain.LabelNull, Word: "2"},
 				{Type: domain.Symbol, Label: domain.SymbolParenthesisClose, Word: ")"},
@@ -43,7 +43,8 @@ func TestParser(t *testing.T) {
 				Left: &domain.Node{
 					Type: domain.Operator,
 					Data: domain.NodeData{
-						Label: domain.OperatorGandr,
+						Label: domain.OperatorSpell,
+						Text: "gandr",
 					},
 				},
 				Right: &domain.Node{
@@ -74,6 +75,155 @@ func TestParser(t *testing.T) {
 				},
 			},
 		},
+		"success: (gandr (- 1) 2)": {
+			Tokens: []domain.LexicalObject{
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisOpen, Word: "("},
+				{Type: domain.KeyWord, Label: domain.KeyWordSpell, Word: "gandr"},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisOpen, Word: "("},
+				{Type: domain.Symbol, Label: domain.SymbolMinus, Word: "-"},
+				{Type: domain.NumberLiteral, Label: domain.LabelNull, Word: "1"},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisClose, Word: ")"},
+				{Type: domain.NumberLiteral, Label: domain.LabelNull, Word: "2"},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisClose, Word: ")"},
+			},
+			IsSuccess: true,
+			ExpectedAST: &domain.Node{
+				Type: domain.Root,
+				Left: &domain.Node{
+					Type: domain.Operator,
+					Data: domain.NodeData{
+						Label: domain.OperatorSpell,
+						Text: "gandr",
+					},
+				},
+				Right: &domain.Node{
+					Type: domain.ArrayHead,
+					Right: &domain.Node{
+						Type: domain.ArrayItem,
+						Left: &domain.Node{
+							Type: domain.Expression,
+							Left: &domain.Node{
+								Type: domain.Operator,
+								Data: domain.NodeData{
+									Label: domain.OperatorSub,
+								},
+							},
+							Right: &domain.Node{
+								Type: domain.ArrayHead,
+								Right: &domain.Node{
+									Type: domain.ArrayItem,
+									Left: &domain.Node{
+										Type: domain.Literal,
+										Data: domain.NodeData{
+											Label: domain.Number,
+											Number: 1,
+										},
+									},
+									Right: &domain.Node{
+										Type: domain.ArrayTail,
+									},
+								},
+							},
+						},
+						Right: &domain.Node{
+							Type: domain.ArrayItem,
+							Left: &domain.Node{
+								Type: domain.Literal,
+								Data: domain.NodeData{
+									Label: domain.Number,
+									Number: 2,
+								},
+							},
+							Right: &domain.Node{
+								Type: domain.ArrayTail,
+							},
+						},
+					},
+				},
+			},
+		},
+		"success: (let ((a 1)) (gandr a a))": {
+			Tokens: []domain.LexicalObject{
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisOpen, Word: "("},
+				{Type: domain.KeyWord, Label: domain.KeyWordLet, Word: "let"},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisOpen, Word: "("},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisOpen, Word: "("},
+				{Type: domain.Identifier, Label: domain.LabelNull, Word: "a"},
+				{Type: domain.NumberLiteral, Label: domain.LabelNull, Word: "1"},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisClose, Word: ")"},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisClose, Word: ")"},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisOpen, Word: "("},
+				{Type: domain.KeyWord, Label: domain.KeyWordSpell, Word: "gandr"},
+				{Type: domain.Identifier, Label: domain.LabelNull, Word: "a"},
+				{Type: domain.Identifier, Label: domain.LabelNull, Word: "a"},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisClose, Word: ")"},
+				{Type: domain.Symbol, Label: domain.SymbolParenthesisClose, Word: ")"},
+			},
+			IsSuccess: true,
+			ExpectedAST: &domain.Node{
+				Type: domain.Root,
+				Left: &domain.Node{
+					Type: domain.Operator,
+					Data: domain.NodeData{Label: domain.OperatorLet},
+				},
+				Right: &domain.Node{
+					Type: domain.ArrayHead,
+					Right: &domain.Node{
+						Type: domain.ArrayItem,
+						Left: &domain.Node{
+							Type: domain.ArrayHead,
+							Right: &domain.Node{
+								Type: domain.ArrayItem,
+								Left: &domain.Node{
+									Type: domain.Binding,
+									Data: domain.NodeData{Label: domain.Name, Text: "a"},
+									Left: &domain.Node{
+										Type: domain.Literal,
+										Data: domain.NodeData{Label: domain.Number, Number: 1},
+									},
+								},
+								Right: &domain.Node{
+									Type: domain.ArrayTail,
+								},
+							},
+						},
+						Right: &domain.Node{
+							Type: domain.ArrayItem,
+							Left: &domain.Node{
+								Type: domain.Expression,
+								Left: &domain.Node{
+									Type: domain.Operator,
+									Data: domain.NodeData{Label: domain.OperatorSpell, Text: "gandr"},
+								},
+								Right: &domain.Node{
+									Type: domain.ArrayHead,
+									Right: &domain.Node{
+										Type: domain.ArrayItem,
+										Left: &domain.Node{
+											Type: domain.Variable,
+											Data: domain.NodeData{Label: domain.Name, Text: "a"},
+										},
+										Right: &domain.Node{
+											Type: domain.ArrayItem,
+											Left: &domain.Node{
+												Type: domain.Variable,
+												Data: domain.NodeData{Label: domain.Name, Text: "a"},
+											},
+											Right: &domain.Node{
+												Type: domain.ArrayTail,
+											},
+										},
+									},
+								},
+							},
+							Right: &domain.Node{
+								Type: domain.ArrayTail,
+							},
+						},
+					},
+				},
+			},
+		},
 	}
 
 	for key, item := range table {
@@ -87,4 +237,90 @@ func TestParser(t *testing.T) {
 			recursiveEqualNode(t, item.ExpectedAST, ast, key)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestErrorPosition(t *testing.T) {
+	type TestItem struct {
+		Arg string
+		ExpectedError Error
+	}
+	table := map[string]TestItem{
+		"lexical error": {
+			Arg: "(gandr 1 2$)",
+			ExpectedError: Error{Pos: domain.Position{Offset: 9, Column: 9}, Expected: "word", Got: "2$"},
+		},
+		"not operator": {
+			Arg: "(1 2)",
+			ExpectedError: Error{Pos: domain.Position{Offset: 1, Column: 1}, Expected: "operator", Got: "1"},
+		},
+		"undefined name after multibyte name": {
+			Arg: "(let ((あ 1)) (gandr あ y))",
+			ExpectedError: Error{Pos: domain.Position{Offset: 26, Column: 22}, Expected: "defined name", Got: "y"},
+		},
+		"if without else": {
+			Arg: "(if (< 1 2) (gandr 1 2))",
+			ExpectedError: Error{Pos: domain.Position{Offset: 23, Column: 23}, Expected: "atom", Got: ")"},
+		},
+		"eof": {
+			Arg: "(gandr (+ 1 2",
+			ExpectedError: Error{Pos: domain.Position{Offset: 13, Column: 13}, Expected: ")", Got: eof},
+		},
+	}
+
+	for key, item := range table {
+		_, err := Compile(item.Arg)
+		var cerr *Error
+		if !assert.ErrorAs(t, err, &cerr, key) {
+			continue
+		}
+		assert.Equal(t, item.ExpectedError, *cerr, key)
+	}
+}
+
+func TestParseIf(t *testing.T) {
+	tokens, err := lexicalAnalyze("(if (>= 3 1) (gandr 1 2) (seiethr 0 0))")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ast, err := parse(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := &domain.Node{
+		Type: domain.Root,
+		Left: &domain.Node{
+			Type: domain.Operator,
+			Data: domain.NodeData{Label: domain.OperatorIf},
+		},
+		Right: &domain.Node{
+			Type: domain.Conditional,
+			Left: &domain.Node{
+				Type: domain.Expression,
+				Left: &domain.Node{
+					Type: domain.Operator,
+					Data: domain.NodeData{Label: domain.OperatorGreaterEqual},
+				},
+				Right: &domain.Node{
+					Type: domain.ArrayHead,
+					Right: &domain.Node{
+						Type: domain.ArrayItem,
+						Left: &domain.Node{Type: domain.Literal, Data: domain.NodeData{Label: domain.Number, Number: 3}},
+						Right: &domain.Node{
+							Type: domain.ArrayItem,
+							Left: &domain.Node{Type: domain.Literal, Data: domain.NodeData{Label: domain.Number, Number: 1}},
+							Right: &domain.Node{Type: domain.ArrayTail},
+						},
+					},
+				},
+			},
+			Right: &domain.Node{
+				Type: domain.Branch,
+				Left: ast.Right.Right.Left,
+				Right: ast.Right.Right.Right,
+			},
+		},
+	}
+	recursiveEqualNode(t, expected, ast, "if")
+	assert.Equal(t, domain.NodeData{Label: domain.OperatorSpell, Text: "gandr"}, ast.Right.Right.Left.Left.Data)
+	assert.Equal(t, domain.NodeData{Label: domain.OperatorSpell, Text: "seiethr"}, ast.Right.Right.Right.Left.Data)
+}
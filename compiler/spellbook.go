@@ -0,0 +1,106 @@
+package compiler
+
+import (
+	"domain"
+	"fmt"
+)
+
+// Spell ... named spell in spell book. only Name and Source are saved and the program is compiled again on load
+type Spell struct {
+	Name string
+	// Source ... canonical source of the spell
+	Source string
+
+	program *Program
+	err     error
+}
+
+// Err ... error of compiling the source. spell with error can not be cast
+func (s *Spell) Err() error {
+	return s.err
+}
+
+// Cast ... run the spell against w. the caster has to know every keyword of the spell
+func (s *Spell) Cast(w World) (magics []domain.Magic, err error) {
+	if s.err != nil {
+		err = s.err
+		return
+	}
+	if _, err = lexicalAnalyzeWith(s.Source, w); err != nil {
+		return
+	}
+	magics, err = NewVM().Run(s.program, w)
+	return
+}
+
+func (s *Spell) compile() {
+	s.program, s.err = Build(s.Source)
+}
+
+// SpellBook ... spells the player named by (define name spell)
+type SpellBook struct {
+	Spells []*Spell
+}
+
+// Define ... read (define name spell) and save the spell to book. a spell of the same name is replaced.
+// ok is false when arg is not define
+func (b *SpellBook) Define(arg string) (spell *Spell, ok bool, err error) {
+	tokens, err := lexicalAnalyze(arg)
+	if err != nil {
+		return
+	}
+	ast, err := parse(tokens)
+	if err != nil {
+		return
+	}
+	if ast.Left == nil || ast.Left.Data.Label != domain.OperatorDefine {
+		return
+	}
+	ok = true
+	if ast.Right == nil || ast.Right.Left == nil {
+		err = fmt.Errorf("internal error: expected binding of define")
+		return
+	}
+
+	body := ast.Right.Left
+	if body.Type != domain.Expression {
+		err = fmt.Errorf("runtime error: %s is not a spell", ast.Right.Data.Text)
+		return
+	}
+	source, err := Format(&domain.Node{Type: domain.Root, Left: body.Left, Right: body.Right})
+	if err != nil {
+		return
+	}
+	spell = &Spell{Name: ast.Right.Data.Text, Source: source}
+	spell.compile()
+	if err = spell.err; err != nil {
+		return
+	}
+
+	for i, s := range b.Spells {
+		if s.Name == spell.Name {
+			b.Spells[i] = spell
+			return
+		}
+	}
+	b.Spells = append(b.Spells, spell)
+	return
+}
+
+// Lookup ... spell named name
+func (b *SpellBook) Lookup(name string) (spell *Spell, ok bool) {
+	for _, s := range b.Spells {
+		if s.Name == name {
+			spell, ok = s, true
+			return
+		}
+	}
+	return
+}
+
+// Recompile ... compile all spells from their source. spells which are broken by changes of compiler keep their error
+func (b *SpellBook) Recompile() {
+	for _, s := range b.Spells {
+		s.compile()
+	}
+}
@@ -0,0 +1,115 @@
+package compiler
+
+import (
+	"testing"
+
+	"github.com/anaseto/gruid"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpellBookDefine(t *testing.T) {
+	type TestItem struct {
+		Arg string
+		IsDefine bool
+		IsSuccess bool
+		ExpectedName string
+		ExpectedSource string
+	}
+	table := map[string]TestItem{
+		"define": {
+			Arg: "(define fireball (seiethr 2 0))",
+			IsDefine: true,
+			IsSuccess: true,
+			ExpectedName: "fireball",
+			ExpectedSource: "(seiethr 2 0)",
+		},
+		"source is normalized": {
+			Arg: "(define  twice\n (let ((d 2)) ; distance\n (seq (gandr d 0) (gandr d   0))))",
+			IsDefine: true,
+			IsSuccess: true,
+			ExpectedName: "twice",
+			ExpectedSource: "(let ((d 2)) (seq (gandr d 0) (gandr d 0)))",
+		},
+		"not define": {
+			Arg: "(gandr 1 2)",
+			IsSuccess: true,
+		},
+		"not spell": {
+			Arg: "(define two (+ 1 1))",
+			IsDefine: true,
+		},
+		"number": {
+			Arg: "(define two 2)",
+		},
+		"no name": {
+			Arg: "(define (gandr 1 2))",
+		},
+		"broken": {
+			Arg: "(define a (gandr 1 2)",
+		},
+	}
+
+	for key, item := range table {
+		book := &SpellBook{}
+		spell, ok, err := book.Define(item.Arg)
+		assert.Equal(t, item.IsDefine, ok, key)
+		if !item.IsSuccess {
+			assert.NotNil(t, err, key)
+			assert.Empty(t, book.Spells, key)
+			continue
+		}
+		if err != nil {
+			t.Fatal(key, err)
+		}
+		if !item.IsDefine {
+			assert.Empty(t, book.Spells, key)
+			continue
+		}
+		assert.Equal(t, item.ExpectedName, spell.Name, key)
+		assert.Equal(t, item.ExpectedSource, spell.Source, key)
+		assert.Equal(t, []*Spell{spell}, book.Spells, key)
+	}
+}
+
+func TestSpellBookCast(t *testing.T) {
+	book := &SpellBook{}
+	for _, arg := range []string{
+		"(define a (gandr 1 0))",
+		"(define b (gandr (nearest-enemy)))",
+		"(define a (seiethr 2 0))",
+	} {
+		if _, _, err := book.Define(arg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	assert.Len(t, book.Spells, 2)
+
+	a, ok := book.Lookup("a")
+	assert.True(t, ok)
+	magics, err := a.Cast(nil)
+	assert.Nil(t, err)
+	assert.Equal(t, "seiethr", magics[0].Name)
+
+	// spell is resolved against game when it is cast
+	b, _ := book.Lookup("b")
+	w := testWorld{caster: 2, hostiles: []gruid.Point{{X: 1, Y: 1}}}
+	magics, err = b.Cast(w)
+	assert.Nil(t, err)
+	assert.Equal(t, gruid.Point{X: 1, Y: 1}, magics[0].Target)
+	assert.Equal(t, 2, magics[0].Actor)
+
+	// caster has to know words of spell in book
+	w.words = map[string]bool{"gandr": true}
+	_, err = b.Cast(w)
+	assert.ErrorContains(t, err, "you don't know this word: nearest-enemy")
+
+	_, ok = book.Lookup("c")
+	assert.False(t, ok)
+
+	// define is not a magic to cast
+	_, err = Compile("(define a (gandr 1 0))")
+	assert.NotNil(t, err)
+	source, err := FormatSource("(define a\n(gandr 1 0))")
+	assert.Nil(t, err)
+	assert.Equal(t, "(define a (gandr 1 0))", source)
+}
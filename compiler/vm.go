@@ -0,0 +1,386 @@
+package compiler
+
+import (
+	"domain"
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/anaseto/gruid"
+)
+
+// DefaultBudget ... number of instructions a spell can execute
+const DefaultBudget = 1000
+
+// ErrBudgetExceeded ... returned when a program runs more instructions than budget of vm
+var ErrBudgetExceeded = errors.New("runtime error: spell is too long to cast")
+
+// ErrOverflow ... result of arithmetic does not fit in int64
+var ErrOverflow = errors.New("runtime error: integer overflow")
+
+// World ... read-only view of game which vm executes spells against
+type World interface {
+	// Vocabulary ... keywords which the caster knows
+	Vocabulary
+	// Caster ... entity id of the caster of spell
+	Caster() int
+	// CasterPosition ... position of the caster on map
+	CasterPosition() gruid.Point
+	// PlayerPosition ... position of the player on map
+	PlayerPosition() gruid.Point
+	// Hostiles ... positions of living hostiles the caster can see
+	Hostiles() []gruid.Point
+	// Named ... positions of living entities named name which the caster can see
+	Named(name string) []gruid.Point
+}
+
+// VM ... stack machine which executes Program
+type VM struct {
+	// Budget ... max number of instructions to execute
+	Budget int
+
+	stack []int64
+	slots []int64
+	// shape ... shape of magics to emit
+	shape domain.MagicShape
+	// element ... element of magics to emit
+	element domain.Element
+	// timings ... turns added by each timing form which is running now
+	timings [timingEnd][]int64
+	// repeats ... loops of repeat which are running now
+	repeats []repeatFrame
+}
+
+// repeatFrame ... state of a loop of repeat
+type repeatFrame struct {
+	times int64
+	// iteration ... 1 in the first iteration. mana of magics is multiplied by it
+	iteration int64
+}
+
+func NewVM() (vm *VM) {
+	vm = &VM{Budget: DefaultBudget}
+	return
+}
+
+// Run ... execute program and return magics it emits in order. w can be nil when spell does not depend on game
+func (vm *VM) Run(p *Program, w World) (magics []domain.Magic, err error) {
+	vm.stack = vm.stack[:0]
+	vm.slots = make([]int64, p.Slots)
+	vm.shape = domain.ShapeCircle
+	vm.element = domain.ElementPhysical
+	for i := range vm.timings {
+		vm.timings[i] = vm.timings[i][:0]
+	}
+	vm.repeats = vm.repeats[:0]
+
+	pc := 0
+	for steps := 0; pc < len(p.Code); steps++ {
+		if steps >= vm.Budget {
+			err = ErrBudgetExceeded
+			return
+		}
+		inst := p.Code[pc]
+		pc++
+
+		switch inst.Op {
+		case OpHalt:
+			pc = len(p.Code)
+		case OpPush:
+			vm.push(inst.Arg)
+		case OpString:
+			if inst.Arg < 0 || inst.Arg >= int64(len(p.Strings)) {
+				err = fmt.Errorf("internal error: string %d out of range", inst.Arg)
+				return
+			}
+			vm.push(inst.Arg)
+		case OpLoad:
+			if inst.Arg < 0 || inst.Arg >= int64(len(vm.slots)) {
+				err = fmt.Errorf("internal error: slot %d out of range", inst.Arg)
+				return
+			}
+			vm.push(vm.slots[inst.Arg])
+		case OpStore:
+			if inst.Arg < 0 || inst.Arg >= int64(len(vm.slots)) {
+				err = fmt.Errorf("internal error: slot %d out of range", inst.Arg)
+				return
+			}
+			var v int64
+			if v, err = vm.pop(); err != nil {
+				return
+			}
+			vm.slots[inst.Arg] = v
+		case OpAdd, OpSub, OpMul, OpDiv, OpLess, OpLessEqual, OpGreater, OpGreaterEqual, OpEqual:
+			var a, b int64
+			if b, err = vm.pop(); err != nil {
+				return
+			}
+			if a, err = vm.pop(); err != nil {
+				return
+			}
+			var v int64
+			if v, err = arithmetic(inst.Op, a, b); err != nil {
+				return
+			}
+			vm.push(v)
+		case OpNeg:
+			var a int64
+			if a, err = vm.pop(); err != nil {
+				return
+			}
+			if a == math.MinInt64 {
+				err = ErrOverflow
+				return
+			}
+			vm.push(-a)
+		case OpJump:
+			pc = int(inst.Arg)
+		case OpJumpIfZero:
+			var a int64
+			if a, err = vm.pop(); err != nil {
+				return
+			}
+			if a == 0 {
+				pc = int(inst.Arg)
+			}
+		case OpShape:
+			if !domain.MagicShape(inst.Arg).Valid() {
+				err = fmt.Errorf("internal error: unknown shape %d", inst.Arg)
+				return
+			}
+			vm.shape = domain.MagicShape(inst.Arg)
+		case OpElement:
+			if !domain.Element(inst.Arg).Valid() {
+				err = fmt.Errorf("internal error: unknown element %d", inst.Arg)
+				return
+			}
+			vm.element = domain.Element(inst.Arg)
+		case OpBeginTiming, OpEndTiming:
+			if inst.Arg < 0 || inst.Arg >= timingEnd {
+				err = fmt.Errorf("internal error: unknown timing %d", inst.Arg)
+				return
+			}
+			if err = vm.timing(inst.Op, inst.Arg); err != nil {
+				return
+			}
+		case OpBeginRepeat:
+			var times int64
+			if times, err = vm.pop(); err != nil {
+				return
+			}
+			if times < 1 || times > domain.MaxRepeat {
+				err = fmt.Errorf("runtime error: repeat must be 1 to %d times but got %d", domain.MaxRepeat, times)
+				return
+			}
+			vm.repeats = append(vm.repeats, repeatFrame{times: times})
+		case OpRepeat:
+			if len(vm.repeats) == 0 {
+				err = errors.New("internal error: repeat without begin")
+				return
+			}
+			frame := &vm.repeats[len(vm.repeats)-1]
+			if frame.iteration >= frame.times {
+				vm.repeats = vm.repeats[:len(vm.repeats)-1]
+				pc = int(inst.Arg)
+				break
+			}
+			frame.iteration++
+		case OpMagic:
+			if inst.Arg < 0 || inst.Arg >= int64(len(p.Strings)) {
+				err = fmt.Errorf("internal error: string %d out of range", inst.Arg)
+				return
+			}
+			var magic domain.Magic
+			if magic, err = vm.magic(p.Strings[inst.Arg]); err != nil {
+				return
+			}
+			magic.Shape = vm.shape
+			magic.Element = vm.element
+			if err = vm.setTiming(&magic); err != nil {
+				return
+			}
+			for _, frame := range vm.repeats {
+				magic.Amount *= int(frame.iteration)
+			}
+			magics = append(magics, magic)
+		case OpCall:
+			if inst.Arg < 0 || inst.Arg >= int64(len(p.Strings)) {
+				err = fmt.Errorf("internal error: string %d out of range", inst.Arg)
+				return
+			}
+			if err = vm.call(p.Strings[inst.Arg], p.Strings, w); err != nil {
+				return
+			}
+		default:
+			err = fmt.Errorf("internal error: unknown op code %d", inst.Op)
+			return
+		}
+	}
+
+	if len(magics) == 0 {
+		err = errors.New("runtime error: spell has no magic")
+		return
+	}
+	if w != nil {
+		for i := range magics {
+			magics[i].Actor = w.Caster()
+		}
+	}
+	return
+}
+
+// magic ... make magic of operator named name with operands on stack
+func (vm *VM) magic(name string) (magic domain.Magic, err error) {
+	op, ok := operators[name]
+	if !ok {
+		err = fmt.Errorf("runtime error: unknown magic %s", name)
+		return
+	}
+	var args []int64
+	if args, err = vm.popN(op.argWidth()); err != nil {
+		return
+	}
+	magic, err = op.newMagic(args)
+	return
+}
+
+// timing ... begin or end timing form
+func (vm *VM) timing(op OpCode, timing int64) (err error) {
+	frames := vm.timings[timing]
+	if op == OpEndTiming {
+		if len(frames) == 0 {
+			err = errors.New("internal error: timing ends without begin")
+			return
+		}
+		vm.timings[timing] = frames[:len(frames)-1]
+		return
+	}
+	turns, err := vm.pop()
+	if err != nil {
+		return
+	}
+	if turns < 0 || turns > domain.MaxSpellTurns {
+		err = fmt.Errorf("runtime error: turns must be 0 to %d but got %d", domain.MaxSpellTurns, turns)
+		return
+	}
+	vm.timings[timing] = append(frames, turns)
+	return
+}
+
+// setTiming ... set delay and duration of timing forms running now to magic. mana is spent for each turn it persists
+func (vm *VM) setTiming(magic *domain.Magic) (err error) {
+	var turns [timingEnd]int64
+	for i, frames := range vm.timings {
+		for _, t := range frames {
+			turns[i] += t
+		}
+		if turns[i] > domain.MaxSpellTurns {
+			err = fmt.Errorf("runtime error: %s of %s is over %d turns", timingWords[i], magic.Name, domain.MaxSpellTurns)
+			return
+		}
+	}
+	magic.Delay = int(turns[timingDelay])
+	magic.Duration = int(turns[timingPersist])
+	magic.Amount *= magic.Duration + 1
+	return
+}
+
+// call ... call builtin named name with arguments on stack. strings is constant pool which string arguments refer
+func (vm *VM) call(name string, strings []string, w World) (err error) {
+	b, ok := builtins[name]
+	if !ok {
+		err = fmt.Errorf("runtime error: unknown function %s", name)
+		return
+	}
+	if w == nil {
+		err = fmt.Errorf("runtime error: %s needs game", name)
+		return
+	}
+	args, err := vm.popN(b.argWidth())
+	if err != nil {
+		return
+	}
+	results, err := b.call(args, strings, w)
+	if err != nil {
+		return
+	}
+	for _, v := range results {
+		vm.push(v)
+	}
+	return
+}
+
+func (vm *VM) push(v int64) {
+	vm.stack = append(vm.stack, v)
+}
+
+func (vm *VM) pop() (v int64, err error) {
+	if len(vm.stack) <= 0 {
+		err = errors.New("internal error: stack underflow")
+		return
+	}
+	v = vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return
+}
+
+// popN ... pop n values. they are in push order
+func (vm *VM) popN(n int) (values []int64, err error) {
+	if len(vm.stack) < n {
+		err = errors.New("internal error: stack underflow")
+		return
+	}
+	values = make([]int64, n)
+	copy(values, vm.stack[len(vm.stack)-n:])
+	vm.stack = vm.stack[:len(vm.stack)-n]
+	return
+}
+
+func arithmetic(op OpCode, a, b int64) (v int64, err error) {
+	switch op {
+	case OpAdd:
+		v = a + b
+		if (b > 0 && v < a) || (b < 0 && v > a) {
+			err = ErrOverflow
+		}
+	case OpSub:
+		v = a - b
+		if (b > 0 && v > a) || (b < 0 && v < a) {
+			err = ErrOverflow
+		}
+	case OpMul:
+		v = a * b
+		if a != 0 && (v/a != b || (a == -1 && b == math.MinInt64)) {
+			err = ErrOverflow
+		}
+	case OpDiv:
+		if b == 0 {
+			err = errors.New("runtime error: division by zero")
+			return
+		}
+		if a == math.MinInt64 && b == -1 {
+			err = ErrOverflow
+			return
+		}
+		v = a / b
+	case OpLess:
+		v = truth(a < b)
+	case OpLessEqual:
+		v = truth(a <= b)
+	case OpGreater:
+		v = truth(a > b)
+	case OpGreaterEqual:
+		v = truth(a >= b)
+	case OpEqual:
+		v = truth(a == b)
+	}
+	return
+}
+
+// truth ... 1 if b, otherwise 0
+func truth(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,195 @@
+package compiler
+
+import (
+	"domain"
+	"math"
+	"testing"
+
+	"github.com/anaseto/gruid"
+	"github.com/stretchr/testify/assert"
+)
+
+type testWorld struct {
+	caster   int
+	position gruid.Point
+	player   gruid.Point
+	hostiles []gruid.Point
+	named    map[string][]gruid.Point
+	// words ... keywords which the caster knows. nil knows every word
+	words map[string]bool
+}
+
+func (w testWorld) Knows(word string) bool {
+	return w.words == nil || w.words[word]
+}
+
+func (w testWorld) Caster() int {
+	return w.caster
+}
+
+func (w testWorld) CasterPosition() gruid.Point {
+	return w.position
+}
+
+func (w testWorld) PlayerPosition() gruid.Point {
+	return w.player
+}
+
+func (w testWorld) Hostiles() []gruid.Point {
+	return w.hostiles
+}
+
+func (w testWorld) Named(name string) []gruid.Point {
+	return w.named[name]
+}
+
+func TestVM(t *testing.T) {
+	type TestItem struct {
+		Program Program
+		Budget int
+		IsSuccess bool
+		ExpectedMagics []domain.Magic
+	}
+	table := map[string]TestItem{
+		"success: arithmetic and slots": {
+			Program: Program{
+				Code: []Instruction{
+					{Op: OpPush, Arg: 3},
+					{Op: OpStore, Arg: 0},
+					{Op: OpLoad, Arg: 0},
+					{Op: OpPush, Arg: 2},
+					{Op: OpMul},
+					{Op: OpLoad, Arg: 0},
+					{Op: OpNeg},
+					{Op: OpMagic, Arg: 0},
+					{Op: OpHalt},
+				},
+				Strings: []string{"gandr"},
+				Slots: 1,
+			},
+			Budget: DefaultBudget,
+			IsSuccess: true,
+			ExpectedMagics: []domain.Magic{{
+				Actor: 7,
+				Amount: gandr.Amount,
+				Damage: gandr.Power,
+				Target: gruid.Point{X: 6, Y: -3},
+				Radius: gandr.Radius,
+				Name: "gandr",
+			}},
+		},
+		"error: infinite loop exceeds budget": {
+			Program: Program{
+				Code: []Instruction{
+					{Op: OpJump, Arg: 0},
+				},
+			},
+			Budget: DefaultBudget,
+			IsSuccess: false,
+		},
+		"error: small budget": {
+			Program: Program{
+				Code: []Instruction{
+					{Op: OpPush, Arg: 1},
+					{Op: OpPush, Arg: 1},
+					{Op: OpMagic, Arg: 0},
+				},
+				Strings: []string{"gandr"},
+			},
+			Budget: 2,
+			IsSuccess: false,
+		},
+		"error: division by zero": {
+			Program: Program{
+				Code: []Instruction{
+					{Op: OpPush, Arg: 1},
+					{Op: OpPush, Arg: 0},
+					{Op: OpDiv},
+				},
+			},
+			Budget: DefaultBudget,
+			IsSuccess: false,
+		},
+		"error: repeat over max is capped": {
+			Program: Program{
+				Code: []Instruction{
+					{Op: OpPush, Arg: domain.MaxRepeat + 1},
+					{Op: OpBeginRepeat},
+					{Op: OpRepeat, Arg: 7},
+					{Op: OpPush, Arg: 1},
+					{Op: OpPush, Arg: 0},
+					{Op: OpMagic, Arg: 0},
+					{Op: OpJump, Arg: 2},
+					{Op: OpHalt},
+				},
+				Strings: []string{"gandr"},
+			},
+			Budget: DefaultBudget,
+			IsSuccess: false,
+		},
+		"error: repeat without begin": {
+			Program: Program{
+				Code: []Instruction{
+					{Op: OpRepeat, Arg: 1},
+				},
+			},
+			Budget: DefaultBudget,
+			IsSuccess: false,
+		},
+		"error: overflow": {
+			Program: Program{
+				Code: []Instruction{
+					{Op: OpPush, Arg: math.MaxInt64},
+					{Op: OpPush, Arg: 1},
+					{Op: OpAdd},
+				},
+			},
+			Budget: DefaultBudget,
+			IsSuccess: false,
+		},
+		"error: target out of sight": {
+			Program: Program{
+				Code: []Instruction{
+					{Op: OpPush, Arg: 1 << 40},
+					{Op: OpPush, Arg: 0},
+					{Op: OpMagic, Arg: 0},
+					{Op: OpHalt},
+				},
+				Strings: []string{"gandr"},
+			},
+			Budget: DefaultBudget,
+			IsSuccess: false,
+		},
+		"error: no magic": {
+			Program: Program{
+				Code: []Instruction{
+					{Op: OpHalt},
+				},
+			},
+			Budget: DefaultBudget,
+			IsSuccess: false,
+		},
+	}
+
+	for key, item := range table {
+		vm := &VM{Budget: item.Budget}
+		magics, err := vm.Run(&item.Program, testWorld{caster: 7})
+		if item.IsSuccess && err != nil {
+			t.Fatal(err)
+		}
+
+		if !item.IsSuccess {
+			assert.NotNil(t, err, key)
+			continue
+		}
+		assert.Equal(t, item.ExpectedMagics, magics, key)
+	}
+
+	loop := table["error: infinite loop exceeds budget"].Program
+	_, err := NewVM().Run(&loop, nil)
+	assert.ErrorIs(t, err, ErrBudgetExceeded)
+
+	overflow := table["error: overflow"].Program
+	_, err = NewVM().Run(&overflow, nil)
+	assert.ErrorIs(t, err, ErrOverflow)
+}
@@ -0,0 +1,79 @@
+package compiler
+
+import (
+	"domain"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// Vocabulary ... words which a caster knows. core words such as let, if and define are known by everyone
+// and the other keywords have to be learned before they are used in spell
+type Vocabulary interface {
+	Knows(word string) bool
+}
+
+// learnable ... token is keyword which a caster has to learn
+func learnable(token domain.LexicalObject) bool {
+	if token.Type != domain.KeyWord {
+		return false
+	}
+	switch token.Label {
+	case domain.KeyWordSpell, domain.KeyWordBuiltin, domain.KeyWordShape, domain.KeyWordElement, domain.KeyWordDelay, domain.KeyWordPersist, domain.KeyWordRepeat:
+		return true
+	}
+	return false
+}
+
+// requiredWord ... word which a caster has to know to use token. string operand targets by name through nearest-named
+func requiredWord(token domain.LexicalObject) (word string, ok bool) {
+	switch {
+	case token.Type == domain.StringLiteral:
+		word, ok = "nearest-named", true
+	case learnable(token):
+		word, ok = token.Word, true
+	}
+	return
+}
+
+// LearnableWords ... keywords which a caster has to learn in sorted order
+func LearnableWords() (words []string) {
+	candidates := []string{}
+	for w := range keyWords {
+		candidates = append(candidates, w)
+	}
+	for w := range builtins {
+		candidates = append(candidates, w)
+	}
+	for w := range operators {
+		candidates = append(candidates, w)
+	}
+	for _, w := range candidates {
+		if token, err := getLexicalObjectFromWord(w); err == nil && learnable(token) {
+			words = append(words, w)
+		}
+	}
+	sort.Strings(words)
+	return
+}
+
+// lexicalAnalyzeWith ... lexical analyze of spell of a caster who knows words of v. every word is known if v is nil
+func lexicalAnalyzeWith(arg string, v Vocabulary) (tokens []domain.LexicalObject, err error) {
+	tokens, err = lexicalAnalyze(arg)
+	if err != nil || v == nil {
+		return
+	}
+	for _, token := range tokens {
+		if word, ok := requiredWord(token); ok && !v.Knows(word) {
+			err = &Diagnostic{
+				Pos:      token.Pos,
+				Severity: SeverityError,
+				Message:  fmt.Sprintf("you don't know this word: %s", word),
+				width:    utf8.RuneCountInString(token.Word),
+			}
+			tokens = nil
+			return
+		}
+	}
+	return
+}
@@ -26,11 +26,15 @@ const (
     ColorLogSpecial
     ColorStatusHealthy
     ColorStatusWounded
+    ColorPendingMagic
+    ColorTargetArea
 )
 
 const (
 	Wall rl.Cell = iota
 	Floor 
+	StairsDown
+	StairsUp
 	MinCaveSize = 400
     MapWidth = UIWidth
     MapHight = UIHight - LogLines - StatusLines
@@ -38,16 +42,25 @@ const (
 
 const (
 	MaxLOS = 10
+	// MaxSpellTurns ... max turns which magics are delayed or persist
+	MaxSpellTurns = 10
+	// MaxRepeat ... max times which repeat casts its form
+	MaxRepeat = 5
 )
 
 const (
     ErrNoShow = "ErrNoShow"
     ErrNoTargeting = "error no targeting"
+    ErrNotEnoughMana = "not enough mana"
     HealRate = 0
 )
 
 const (
     EnemyNumber = 12
+    // EnemiesPerDepth ... enemies added to each level below the first
+    EnemiesPerDepth = 4
+    // MaxDepth ... depth of the bottom level where the boss waits
+    MaxDepth = 3
     ItemNumber = 10
     AmountOfHealthPortion = 100
     DamageMagicArrowScroll = 5
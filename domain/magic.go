@@ -9,6 +9,9 @@ const (
 	Symbol
 	KeyWord
 	NumberLiteral
+	Identifier
+	// StringLiteral ... quoted string. Word is the source text including quotes
+	StringLiteral
 )
 
 type LexicalObjectLabel int 
@@ -16,16 +19,48 @@ const (
 	LabelNull LexicalObjectLabel = iota 
 	SymbolParenthesisOpen
 	SymbolParenthesisClose
-	KeyWordGandr
-	KeyWordSeiethr	
+	// KeyWordSpell ... name of magic operator in registry of compiler. Word is the name
+	KeyWordSpell
+	SymbolPlus
+	SymbolMinus
+	SymbolAsterisk
+	SymbolSlash
+	KeyWordLet
+	KeyWordSeq
+	// KeyWordBuiltin ... name of function which queries game. Word is the name
+	KeyWordBuiltin
+	KeyWordIf
+	SymbolLess
+	SymbolLessEqual
+	SymbolGreater
+	SymbolGreaterEqual
+	SymbolEqual
+	KeyWordDefine
+	// KeyWordShape ... name of shape of area which magics in the form affect. Word is the name
+	KeyWordShape
+	// KeyWordElement ... name of element of magics in the form. Word is the name
+	KeyWordElement
+	KeyWordDelay
+	KeyWordPersist
+	KeyWordRepeat
 )
 
+// Position ... place of a lexical object in spell source
+type Position struct {
+	// Offset ... byte offset from head of source
+	Offset int
+	// Column ... number of runes before the object
+	Column int
+}
+
 type LexicalObject struct {
 	Type LexicalObjectType
 	// Label ... this field has meaning when type is symbol or keyword
 	Label LexicalObjectLabel
 	//Unit of this object
 	Word string 
+	// Pos ... where this object begins in source
+	Pos Position
 }
 
 type NodeType int 
@@ -36,6 +71,16 @@ const (
 	ArrayHead
 	ArrayItem
 	ArrayTail
+	// Expression ... nested (operator operands...). Left is operator and Right is operands
+	Expression
+	// Variable ... reference to a name bound by let. Data.Text is the name
+	Variable
+	// Binding ... a pair of let. Data.Text is the name and Left is the value
+	Binding
+	// Conditional ... operands of if. Left is the condition and Right is Branch
+	Conditional
+	// Branch ... Left is evaluated when condition is not 0, otherwise Right
+	Branch
 )
 
 type DataLabel int 
@@ -43,13 +88,44 @@ const (
 	Null DataLabel = iota 
 	Number 
 	String 
-	OperatorGandr
-	OperatorSeiethr
+	// OperatorSpell ... magic operator. Text is name of the magic
+	OperatorSpell
+	OperatorAdd
+	OperatorSub
+	OperatorMul
+	OperatorDiv
+	OperatorLet
+	// Name ... name of variable
+	Name
+	// OperatorSeq ... cast forms in order
+	OperatorSeq
+	// OperatorBuiltin ... call of function which queries game. Text is name of the function
+	OperatorBuiltin
+	// OperatorIf ... choose one of 2 branches by condition at cast time
+	OperatorIf
+	// comparison. they make 1 if it holds, otherwise 0
+	OperatorLess
+	OperatorLessEqual
+	OperatorGreater
+	OperatorGreaterEqual
+	OperatorEqual
+	// OperatorDefine ... name a spell to save it to spell book. operand is Binding of the name and the spell
+	OperatorDefine
+	// OperatorShape ... magics in the operand form affect area of shape. Text is the name of shape
+	OperatorShape
+	// OperatorElement ... magics in the operand form deal damage of element. Text is the name of element
+	OperatorElement
+	// OperatorDelay ... magics in the form take effect after turns of the first operand
+	OperatorDelay
+	// OperatorPersist ... magics in the form take effect again for turns of the first operand
+	OperatorPersist
+	// OperatorRepeat ... magics in the form are cast times of the first operand. each iteration costs more mana
+	OperatorRepeat
 )
 
 type NodeData struct {
 	Label DataLabel 
-	// Text ... this field have meaning when label is string or Null
+	// Text ... this field have meaning when label is string, name or Null
 	Text string
 	// Number ... this field have meaning when label is number 
 	Number int64
@@ -61,23 +137,79 @@ type Node struct {
 	// Left and Right have meaning when type is Pair
 	Left *Node 
 	Right *Node
+	// Pos ... position of token which this node is made from
+	Pos Position
+}
+
+// MagicEffect ... what a magic does to entities in affected area
+type MagicEffect int
+const (
+	EffectDamage MagicEffect = iota
+)
+
+// Element ... type of damage. resistances of entities depend on it
+type Element int
+const (
+	// ElementPhysical ... blows and plain mana. defence reduces it
+	ElementPhysical Element = iota
+	ElementFire
+	ElementFrost
+	ElementLightning
+	elementEnd
+)
+
+// Valid ... e is a known element
+func (e Element) Valid() bool {
+	return e >= ElementPhysical && e < elementEnd
+}
+
+// MagicShape ... shape of area which a magic affects
+type MagicShape int
+const (
+	// ShapeCircle ... cells within Radius of the target
+	ShapeCircle MagicShape = iota
+	// ShapeLine ... beam from the caster to the target
+	ShapeLine
+	// ShapeCone ... cells spreading from the caster toward the target as far as the target
+	ShapeCone
+	// ShapeCross ... cells on row and column of the target within Radius
+	ShapeCross
+	shapeEnd
+)
+
+// Valid ... s is a known shape
+func (s MagicShape) Valid() bool {
+	return s >= ShapeCircle && s < shapeEnd
 }
 
 type Magic struct {
 	// actor ... caster of this magic 
 	Actor int 
-	// amount of mana
+	// amount of mana which caster spends
 	Amount int	
+	// Damage ... damage to each entity in affected area
+	Damage int
+	// Effect ... kind of magic
+	Effect MagicEffect
 	// Target ... target of magic
 	Target gruid.Point
 	// Radius ... Radius of magic 
 	Radius int
+	// Shape ... shape of affected area. Radius is not used by line and cone
+	Shape MagicShape
+	// Element ... type of damage
+	Element Element
+	// Delay ... turns before the magic takes effect. 0 is now
+	Delay int
+	// Duration ... number of turns the magic takes effect again after the first time
+	Duration int
 	// Name ... Name of magic <-- concatenating atoms
 	Name string
 }
 
 var MagicArrow = Magic {
 	Amount: 4,
+	Damage: 4,
 	Radius: 0,
 	Name: "gandr",
 }
\ No newline at end of file
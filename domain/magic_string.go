@@ -0,0 +1,191 @@
+package domain
+
+import "fmt"
+
+func (t LexicalObjectType) String() string {
+	switch t {
+	case NotLexicalObject:
+		return "NotLexicalObject"
+	case Symbol:
+		return "Symbol"
+	case KeyWord:
+		return "KeyWord"
+	case NumberLiteral:
+		return "NumberLiteral"
+	case Identifier:
+		return "Identifier"
+	case StringLiteral:
+		return "StringLiteral"
+	}
+	return fmt.Sprintf("LexicalObjectType(%d)", int(t))
+}
+
+func (l LexicalObjectLabel) String() string {
+	switch l {
+	case LabelNull:
+		return "LabelNull"
+	case SymbolParenthesisOpen:
+		return "SymbolParenthesisOpen"
+	case SymbolParenthesisClose:
+		return "SymbolParenthesisClose"
+	case KeyWordSpell:
+		return "KeyWordSpell"
+	case SymbolPlus:
+		return "SymbolPlus"
+	case SymbolMinus:
+		return "SymbolMinus"
+	case SymbolAsterisk:
+		return "SymbolAsterisk"
+	case SymbolSlash:
+		return "SymbolSlash"
+	case KeyWordLet:
+		return "KeyWordLet"
+	case KeyWordSeq:
+		return "KeyWordSeq"
+	case KeyWordBuiltin:
+		return "KeyWordBuiltin"
+	case KeyWordIf:
+		return "KeyWordIf"
+	case SymbolLess:
+		return "SymbolLess"
+	case SymbolLessEqual:
+		return "SymbolLessEqual"
+	case SymbolGreater:
+		return "SymbolGreater"
+	case SymbolGreaterEqual:
+		return "SymbolGreaterEqual"
+	case SymbolEqual:
+		return "SymbolEqual"
+	case KeyWordDefine:
+		return "KeyWordDefine"
+	case KeyWordShape:
+		return "KeyWordShape"
+	case KeyWordElement:
+		return "KeyWordElement"
+	case KeyWordDelay:
+		return "KeyWordDelay"
+	case KeyWordPersist:
+		return "KeyWordPersist"
+	case KeyWordRepeat:
+		return "KeyWordRepeat"
+	}
+	return fmt.Sprintf("LexicalObjectLabel(%d)", int(l))
+}
+
+func (t NodeType) String() string {
+	switch t {
+	case Root:
+		return "Root"
+	case Operator:
+		return "Operator"
+	case Literal:
+		return "Literal"
+	case ArrayHead:
+		return "ArrayHead"
+	case ArrayItem:
+		return "ArrayItem"
+	case ArrayTail:
+		return "ArrayTail"
+	case Expression:
+		return "Expression"
+	case Variable:
+		return "Variable"
+	case Binding:
+		return "Binding"
+	case Conditional:
+		return "Conditional"
+	case Branch:
+		return "Branch"
+	}
+	return fmt.Sprintf("NodeType(%d)", int(t))
+}
+
+func (l DataLabel) String() string {
+	switch l {
+	case Null:
+		return "Null"
+	case Number:
+		return "Number"
+	case String:
+		return "String"
+	case OperatorSpell:
+		return "OperatorSpell"
+	case OperatorAdd:
+		return "OperatorAdd"
+	case OperatorSub:
+		return "OperatorSub"
+	case OperatorMul:
+		return "OperatorMul"
+	case OperatorDiv:
+		return "OperatorDiv"
+	case OperatorLet:
+		return "OperatorLet"
+	case Name:
+		return "Name"
+	case OperatorSeq:
+		return "OperatorSeq"
+	case OperatorBuiltin:
+		return "OperatorBuiltin"
+	case OperatorIf:
+		return "OperatorIf"
+	case OperatorLess:
+		return "OperatorLess"
+	case OperatorLessEqual:
+		return "OperatorLessEqual"
+	case OperatorGreater:
+		return "OperatorGreater"
+	case OperatorGreaterEqual:
+		return "OperatorGreaterEqual"
+	case OperatorEqual:
+		return "OperatorEqual"
+	case OperatorDefine:
+		return "OperatorDefine"
+	case OperatorShape:
+		return "OperatorShape"
+	case OperatorElement:
+		return "OperatorElement"
+	case OperatorDelay:
+		return "OperatorDelay"
+	case OperatorPersist:
+		return "OperatorPersist"
+	case OperatorRepeat:
+		return "OperatorRepeat"
+	}
+	return fmt.Sprintf("DataLabel(%d)", int(l))
+}
+
+func (e MagicEffect) String() string {
+	switch e {
+	case EffectDamage:
+		return "damage"
+	}
+	return fmt.Sprintf("MagicEffect(%d)", int(e))
+}
+
+func (s MagicShape) String() string {
+	switch s {
+	case ShapeCircle:
+		return "circle"
+	case ShapeLine:
+		return "line"
+	case ShapeCone:
+		return "cone"
+	case ShapeCross:
+		return "cross"
+	}
+	return fmt.Sprintf("MagicShape(%d)", int(s))
+}
+
+func (e Element) String() string {
+	switch e {
+	case ElementPhysical:
+		return "physical"
+	case ElementFire:
+		return "fire"
+	case ElementFrost:
+		return "frost"
+	case ElementLightning:
+		return "lightning"
+	}
+	return fmt.Sprintf("Element(%d)", int(e))
+}
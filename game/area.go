@@ -0,0 +1,215 @@
+package game
+
+import (
+	"compiler"
+	"domain"
+	"fmt"
+
+	"github.com/anaseto/gruid"
+)
+
+// MagicArea ... cells which magic cast from origin affects. walls block the magic,
+// so a cell is affected only if the line of effect to it passes walkable cells.
+// magic whose target is out of sight affects nothing
+func (g *Game) MagicArea(origin gruid.Point, magic domain.Magic) (area []gruid.Point) {
+	if !inSight(magic.Target) {
+		return
+	}
+	target := origin.Add(magic.Target)
+	switch magic.Shape {
+	case domain.ShapeLine:
+		walkLine(origin, target, func(p gruid.Point) bool {
+			if !g.Map.IsWalkable(p) {
+				return false
+			}
+			area = append(area, p)
+			return true
+		})
+	case domain.ShapeCone:
+		reach := magic.Target.X*magic.Target.X + magic.Target.Y*magic.Target.Y
+		g.eachInRange(origin, distanceCeil(reach), func(p gruid.Point) {
+			d := p.Sub(origin)
+			if d == (gruid.Point{}) || d.X*d.X+d.Y*d.Y > reach || !inCone(d, magic.Target) {
+				return
+			}
+			if g.lineOfEffect(origin, p) {
+				area = append(area, p)
+			}
+		})
+	default:
+		center := g.blastCenter(origin, target)
+		g.eachInRange(center, magic.Radius, func(p gruid.Point) {
+			d := p.Sub(center)
+			if magic.Shape == domain.ShapeCross && d.X != 0 && d.Y != 0 {
+				return
+			}
+			if d.X*d.X+d.Y*d.Y > magic.Radius*magic.Radius {
+				return
+			}
+			if g.lineOfEffect(center, p) {
+				area = append(area, p)
+			}
+		})
+	}
+	return
+}
+
+// blastCenter ... explosion happens where the bolt hits a wall on the way to the target
+func (g *Game) blastCenter(origin, target gruid.Point) (center gruid.Point) {
+	center = origin
+	walkLine(origin, target, func(p gruid.Point) bool {
+		if !g.Map.IsWalkable(p) {
+			return false
+		}
+		center = p
+		return true
+	})
+	return
+}
+
+// Backfires ... magics which stop at a wall short of their target and hit their caster.
+// compiler warns magics aimed at the caster but can not see walls, so they are checked on the map
+func (g *Game) Backfires(magics []domain.Magic) (backfires []domain.Magic) {
+	for _, magic := range magics {
+		if magic.Shape == domain.ShapeLine || magic.Shape == domain.ShapeCone || !inSight(magic.Target) {
+			continue
+		}
+		origin := g.ECS.Positions[magic.Actor]
+		target := origin.Add(magic.Target)
+		if g.blastCenter(origin, target) == target {
+			continue
+		}
+		for _, p := range g.MagicArea(origin, magic) {
+			if p == origin {
+				backfires = append(backfires, magic)
+				break
+			}
+		}
+	}
+	return
+}
+
+// PredictMagics ... mana cost of magics, their targets and cells they will affect if they are cast now.
+// targets out of sight are left out
+func (g *Game) PredictMagics(magics []domain.Magic) (cost int, targets []gruid.Point, area map[gruid.Point]bool) {
+	area = map[gruid.Point]bool{}
+	for _, magic := range magics {
+		origin := g.ECS.Positions[magic.Actor]
+		cost += magic.Amount
+		if !inSight(magic.Target) {
+			continue
+		}
+		targets = append(targets, origin.Add(magic.Target))
+		for _, p := range g.MagicArea(origin, magic) {
+			area[p] = true
+		}
+	}
+	return
+}
+
+// PredictSpell ... compile spell source cast by the player now and predict its magics.
+// they are predicted only after every target is known to be in sight, so a preview of a far target does not walk its line
+func (g *Game) PredictSpell(source string) (magics []domain.Magic, cost int, targets []gruid.Point, area map[gruid.Point]bool, err error) {
+	magics, err = compiler.CompileWith(source, g.ViewFrom(g.ECS.PlayerID))
+	if err != nil {
+		return
+	}
+	for _, magic := range magics {
+		if !inSight(magic.Target) {
+			err = fmt.Errorf("target (%d, %d) of %s is out of sight", magic.Target.X, magic.Target.Y, magic.Name)
+			return
+		}
+	}
+	cost, targets, area = g.PredictMagics(magics)
+	return
+}
+
+// eachInRange ... call f with each cell of map in square of radius around center
+func (g *Game) eachInRange(center gruid.Point, radius int, f func(p gruid.Point)) {
+	rg := gruid.NewRange(center.X-radius, center.Y-radius, center.X+radius+1, center.Y+radius+1)
+	rg = rg.Intersect(g.Map.Grid.Range())
+	rg.Iter(f)
+}
+
+// lineOfEffect ... every cell from from to to except from is walkable
+func (g *Game) lineOfEffect(from, to gruid.Point) (ok bool) {
+	ok = true
+	walkLine(from, to, func(p gruid.Point) bool {
+		ok = g.Map.IsWalkable(p)
+		return ok
+	})
+	return
+}
+
+// inSight ... target d relative to the caster is within MaxLOS in manhattan distance.
+// each axis is compared first so that a huge d does not overflow
+func inSight(d gruid.Point) bool {
+	if d.X < -domain.MaxLOS || d.X > domain.MaxLOS || d.Y < -domain.MaxLOS || d.Y > domain.MaxLOS {
+		return false
+	}
+	return abs(d.X)+abs(d.Y) <= domain.MaxLOS
+}
+
+// inCone ... d is within 45 degrees of direction
+func inCone(d, direction gruid.Point) bool {
+	dot := d.X*direction.X + d.Y*direction.Y
+	if dot <= 0 {
+		return false
+	}
+	// cos^2 of angle between them >= 1/2
+	return 2*dot*dot >= (d.X*d.X+d.Y*d.Y)*(direction.X*direction.X+direction.Y*direction.Y)
+}
+
+// distanceCeil ... smallest distance whose square is at least square
+func distanceCeil(square int) (distance int) {
+	for distance*distance < square {
+		distance++
+	}
+	return
+}
+
+// Bresenham ... cells of line from from to to. both ends are included
+func Bresenham(from, to gruid.Point) (line []gruid.Point) {
+	line = []gruid.Point{from}
+	walkLine(from, to, func(p gruid.Point) bool {
+		line = append(line, p)
+		return true
+	})
+	return
+}
+
+// walkLine ... call f with each cell of line from from to to except from until f returns false.
+// cells are made one by one, so the walk ends at the first cell f rejects however far to is
+func walkLine(from, to gruid.Point, f func(p gruid.Point) bool) {
+	dx, dy := abs(to.X-from.X), -abs(to.Y-from.Y)
+	sx, sy := 1, 1
+	if from.X > to.X {
+		sx = -1
+	}
+	if from.Y > to.Y {
+		sy = -1
+	}
+	e := dx + dy
+	p := from
+	for p != to {
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			p.X += sx
+		}
+		if e2 <= dx {
+			e += dx
+			p.Y += sy
+		}
+		if !f(p) {
+			return
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
@@ -0,0 +1,178 @@
+package game
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"testing"
+
+	"domain"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/rl"
+)
+
+// newAreaGame ... game whose map is open floor of 9x9 with walls at walls
+func newAreaGame(walls ...gruid.Point) (g *Game) {
+	g = &Game{Map: &GameMap{Grid: rl.NewGrid(9, 9)}}
+	g.Map.Grid.Fill(domain.Floor)
+	for _, p := range walls {
+		g.Map.Grid.Set(p, domain.Wall)
+	}
+	return
+}
+
+func TestMagicArea(t *testing.T) {
+	type TestItem struct {
+		Walls []gruid.Point
+		Magic domain.Magic
+		ExpectedArea []gruid.Point
+	}
+	origin := gruid.Point{X: 4, Y: 4}
+	table := map[string]TestItem{
+		"single cell": {
+			Magic: domain.Magic{Target: gruid.Point{X: 2}},
+			ExpectedArea: []gruid.Point{{X: 6, Y: 4}},
+		},
+		"circle": {
+			Magic: domain.Magic{Target: gruid.Point{X: 2}, Radius: 1},
+			ExpectedArea: []gruid.Point{{X: 6, Y: 3}, {X: 5, Y: 4}, {X: 6, Y: 4}, {X: 7, Y: 4}, {X: 6, Y: 5}},
+		},
+		"circle blocked by wall": {
+			Walls: []gruid.Point{{X: 7, Y: 3}, {X: 7, Y: 4}, {X: 7, Y: 5}},
+			Magic: domain.Magic{Target: gruid.Point{X: 2}, Radius: 2},
+			ExpectedArea: []gruid.Point{
+				{X: 6, Y: 2},
+				{X: 5, Y: 3}, {X: 6, Y: 3},
+				{X: 4, Y: 4}, {X: 5, Y: 4}, {X: 6, Y: 4},
+				{X: 5, Y: 5}, {X: 6, Y: 5},
+				{X: 6, Y: 6},
+			},
+		},
+		"bolt stops at wall": {
+			Walls: []gruid.Point{{X: 6, Y: 4}},
+			Magic: domain.Magic{Target: gruid.Point{X: 3}},
+			ExpectedArea: []gruid.Point{{X: 5, Y: 4}},
+		},
+		"line": {
+			Magic: domain.Magic{Target: gruid.Point{X: 3, Y: 3}, Shape: domain.ShapeLine},
+			ExpectedArea: []gruid.Point{{X: 5, Y: 5}, {X: 6, Y: 6}, {X: 7, Y: 7}},
+		},
+		"line blocked by wall": {
+			Walls: []gruid.Point{{X: 4, Y: 2}},
+			Magic: domain.Magic{Target: gruid.Point{Y: -4}, Shape: domain.ShapeLine},
+			ExpectedArea: []gruid.Point{{X: 4, Y: 3}},
+		},
+		"cross": {
+			Magic: domain.Magic{Target: gruid.Point{Y: -2}, Radius: 1, Shape: domain.ShapeCross},
+			ExpectedArea: []gruid.Point{{X: 4, Y: 1}, {X: 3, Y: 2}, {X: 4, Y: 2}, {X: 5, Y: 2}, {X: 4, Y: 3}},
+		},
+		"cone": {
+			Magic: domain.Magic{Target: gruid.Point{X: 2}, Shape: domain.ShapeCone},
+			ExpectedArea: []gruid.Point{{X: 5, Y: 3}, {X: 5, Y: 4}, {X: 6, Y: 4}, {X: 5, Y: 5}},
+		},
+		"cone behind wall": {
+			Walls: []gruid.Point{{X: 5, Y: 4}},
+			Magic: domain.Magic{Target: gruid.Point{X: 2}, Shape: domain.ShapeCone},
+			ExpectedArea: []gruid.Point{{X: 5, Y: 3}, {X: 5, Y: 5}},
+		},
+		"line stops at edge of map": {
+			Magic: domain.Magic{Target: gruid.Point{X: 10}, Shape: domain.ShapeLine},
+			ExpectedArea: []gruid.Point{{X: 5, Y: 4}, {X: 6, Y: 4}, {X: 7, Y: 4}, {X: 8, Y: 4}},
+		},
+		"line out of sight": {
+			Magic: domain.Magic{Target: gruid.Point{X: math.MaxInt, Y: 1}, Shape: domain.ShapeLine},
+		},
+		"cone out of sight": {
+			Magic: domain.Magic{Target: gruid.Point{X: math.MaxInt, Y: math.MinInt}, Shape: domain.ShapeCone},
+		},
+		"circle out of sight": {
+			Magic: domain.Magic{Target: gruid.Point{X: 6, Y: 5}, Radius: 1},
+		},
+	}
+
+	for key, item := range table {
+		area := newAreaGame(item.Walls...).MagicArea(origin, item.Magic)
+		sort.Slice(area, func(i, j int) bool {
+			if area[i].Y != area[j].Y {
+				return area[i].Y < area[j].Y
+			}
+			return area[i].X < area[j].X
+		})
+		if !reflect.DeepEqual(item.ExpectedArea, area) {
+			t.Errorf("%s: expect area %v but got %v", key, item.ExpectedArea, area)
+		}
+	}
+}
+
+func TestBresenham(t *testing.T) {
+	table := map[string]struct {
+		From, To gruid.Point
+		Expected []gruid.Point
+	}{
+		"shallow": {
+			To: gruid.Point{X: 4, Y: -2},
+			Expected: []gruid.Point{{X: 0, Y: 0}, {X: 1, Y: -1}, {X: 2, Y: -1}, {X: 3, Y: -2}, {X: 4, Y: -2}},
+		},
+		"steep": {
+			To: gruid.Point{X: -1, Y: 3},
+			Expected: []gruid.Point{{X: 0, Y: 0}, {X: 0, Y: 1}, {X: -1, Y: 2}, {X: -1, Y: 3}},
+		},
+		"same point": {
+			From: gruid.Point{X: 3, Y: 3},
+			To: gruid.Point{X: 3, Y: 3},
+			Expected: []gruid.Point{{X: 3, Y: 3}},
+		},
+	}
+
+	for key, item := range table {
+		line := Bresenham(item.From, item.To)
+		if !reflect.DeepEqual(item.Expected, line) {
+			t.Errorf("%s: expect line %v but got %v", key, item.Expected, line)
+		}
+	}
+}
+
+func TestPredictMagics(t *testing.T) {
+	g := NewGame(1)
+	pp := g.ECS.PlayerPosition()
+	magics := []domain.Magic{
+		{Actor: g.ECS.PlayerID, Amount: 5, Name: "gandr"},
+		{Actor: g.ECS.PlayerID, Amount: 10, Radius: 1, Duration: 1, Name: "seiethr"},
+	}
+	cost, targets, area := g.PredictMagics(magics)
+	if cost != 15 {
+		t.Fatalf("expect cost 15 but got %d", cost)
+	}
+	if !reflect.DeepEqual([]gruid.Point{pp, pp}, targets) {
+		t.Fatalf("expect targets at player but got %v", targets)
+	}
+	if !area[pp] {
+		t.Fatalf("expect area contains %v", pp)
+	}
+	if len(g.Logs) != 0 || g.ECS.Statuses[g.ECS.PlayerID].Mana != 20 || len(g.Pending) != 0 {
+		t.Fatal("prediction changed game")
+	}
+
+	far := domain.Magic{Actor: g.ECS.PlayerID, Amount: 5, Target: gruid.Point{X: math.MaxInt / 2}, Shape: domain.ShapeCone, Name: "gandr"}
+	cost, targets, area = g.PredictMagics([]domain.Magic{far})
+	if cost != 5 || len(targets) != 0 || len(area) != 0 {
+		t.Fatalf("expect target out of sight is left out but got targets %v and area %v", targets, area)
+	}
+}
+
+func TestBackfires(t *testing.T) {
+	g := newAreaGame(gruid.Point{X: 5, Y: 4})
+	g.ECS = NewEcs()
+	caster := g.ECS.AddEntity(&Player{}, gruid.Point{X: 4, Y: 4})
+	blocked := domain.Magic{Actor: caster, Target: gruid.Point{X: 3}, Radius: 1, Name: "seiethr"}
+	open := domain.Magic{Actor: caster, Target: gruid.Point{Y: 3}, Radius: 1, Name: "seiethr"}
+	// magic aimed at the caster is warned by compiler
+	aimed := domain.Magic{Actor: caster, Radius: 1, Name: "seiethr"}
+	line := domain.Magic{Actor: caster, Target: gruid.Point{X: 3}, Radius: 1, Shape: domain.ShapeLine, Name: "seiethr"}
+
+	backfires := g.Backfires([]domain.Magic{blocked, open, aimed, line})
+	if !reflect.DeepEqual([]domain.Magic{blocked}, backfires) {
+		t.Fatalf("expect only magic blocked by wall backfires but got %v", backfires)
+	}
+}
@@ -1,16 +1,31 @@
 package game
 
-import  	"github.com/anaseto/gruid"
+import (
+    "domain"
+
+    "github.com/anaseto/gruid"
+)
 
 type Status struct {
     HP int 
     MaxHP int 
     Power int 
     Defence int 
+    Mana int
+    MaxMana int
+    ManaRegen int // mana recovered at end of each turn
+    // Resistances ... percent of damage of each element which is cut. negative value is vulnerability
+    Resistances map[domain.Element]int
 }
 
 type EnemyAI struct {
     Path []gruid.Point
+    // Spells ... sources of spells which the enemy casts in order of preference
+    Spells []string
+    // SpellRange ... the enemy casts spells when the player is within this distance
+    SpellRange int
+    // Boss ... the enemy is the boss. defeating it at the bottom clears the game
+    Boss bool
 }
 
 func (st *Status) Heal(n int) (healedHP int) {
@@ -23,8 +38,32 @@ func (st *Status) Heal(n int) (healedHP int) {
     return 
 }
 
-func (st *Status)Damage(n int) (damagedHP int) {
-    damage := n - st.Defence
+// SpendMana ... consume n mana. returns false and keeps mana as it is if mana is not enough
+func (st *Status) SpendMana(n int) (ok bool) {
+    if st.Mana < n {
+        return
+    }
+    st.Mana -= n
+    ok = true
+    return
+}
+
+func (st *Status) RegenMana() {
+    st.Mana += st.ManaRegen
+    if st.Mana > st.MaxMana {
+        st.Mana = st.MaxMana
+    }
+}
+
+// Damage ... take n damage of element. resistance to element scales it and defence reduces physical damage
+func (st *Status)Damage(n int, element domain.Element) (damagedHP int) {
+    damage := n * (100 - st.Resistances[element]) / 100
+    if element == domain.ElementPhysical {
+        damage -= st.Defence
+    }
+    if damage < 0 {
+        damage = 0
+    }
     st.HP -= damage 
     if st.HP < 0 {
         damage += st.HP
@@ -34,6 +73,24 @@ func (st *Status)Damage(n int) (damagedHP int) {
     return 
 }
 
+// Vocabulary ... keywords of spell which an entity learned
+type Vocabulary map[string]bool
+
+// Knows ... word is learned
+func (v Vocabulary) Knows(word string) bool {
+    return v[word]
+}
+
+// Learn ... learn word. returns false if word is already known
+func (v Vocabulary) Learn(word string) (learned bool) {
+    if v[word] {
+        return
+    }
+    v[word] = true
+    learned = true
+    return
+}
+
 // style contains information relative to default graphical represantation of an entity
 type Style struct {
     Rune rune 
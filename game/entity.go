@@ -1,6 +1,8 @@
 package game
 
 import (
+	"sort"
+
 	"domain"
 
 	"github.com/anaseto/gruid"
@@ -9,28 +11,34 @@ import (
 
 // Entity Component System
 type ECS struct {
-	Entities  map[int]Entity
-	Positions map[int]gruid.Point // key: index of entity value: position of entity in map
-	PlayerID  int                 // index of player
+	Entities  Store[Entity]
+	Positions Store[gruid.Point] // key: index of entity value: position of entity in map. change it by SetPosition
+	PlayerID  int                // index of player
     NextID int 
 	Bodies int 
 
-	Statuses map[int]*Status
-	AI       map[int]*EnemyAI
-	Name     map[int]string
-    Styles map[int]Style
-    Inventories map[int]*Inventory
+	Statuses Store[*Status]
+	AI       Store[*EnemyAI]
+	Name     Store[string]
+    Styles Store[Style]
+    Inventories Store[*Inventory]
+    // Vocabularies ... keywords which entity knows. entity without vocabulary knows every keyword
+    Vocabularies Store[Vocabulary]
+
+	// spatial ... entities at each position. it is not saved and is built from Positions when it is nil
+	spatial map[gruid.Point][]int
 }
 
 func NewEcs() *ECS {
 	return &ECS{
-        Entities: map[int]Entity{},
-		Positions: map[int]gruid.Point{},
-		Statuses:  map[int]*Status{},
-		AI:        map[int]*EnemyAI{},
-		Name:      map[int]string{},
-        Styles: map[int]Style{},
-        Inventories: map[int]*Inventory{},
+        Entities: Store[Entity]{},
+		Positions: Store[gruid.Point]{},
+		Statuses:  Store[*Status]{},
+		AI:        Store[*EnemyAI]{},
+		Name:      Store[string]{},
+        Styles: Store[Style]{},
+        Inventories: Store[*Inventory]{},
+        Vocabularies: Store[Vocabulary]{},
         NextID: 0,
 	}
 }
@@ -38,23 +46,83 @@ func NewEcs() *ECS {
 func (ecs *ECS) AddEntity(e Entity, p gruid.Point) (id int) {
 	id = ecs.NextID
     ecs.Entities[id] = e 
-	ecs.Positions[id] = p
+	ecs.SetPosition(id, p)
     ecs.NextID++
 	return 
 }
 
 func (ecs *ECS) RemoveEntity (id int) {
+    ecs.RemovePosition(id)
     delete(ecs.Entities, id)
-    delete(ecs.Positions, id)
     delete(ecs.Statuses, id)
     delete(ecs.AI, id)
     delete(ecs.Name, id)
     delete(ecs.Styles, id)
     delete(ecs.Inventories, id)
+    delete(ecs.Vocabularies, id)
 }
 
-func (ecs *ECS) MoveEntity(id int, p gruid.Point) {
+// SetPosition ... put entity id at p keeping spatial index
+func (ecs *ECS) SetPosition(id int, p gruid.Point) {
+	index := ecs.spatialIndex()
+	if q, ok := ecs.Positions[id]; ok {
+		index[q] = without(index[q], id)
+	}
 	ecs.Positions[id] = p
+	index[p] = insertSorted(index[p], id)
+}
+
+// RemovePosition ... take entity id off map. e.g. item picked up
+func (ecs *ECS) RemovePosition(id int) {
+	q, ok := ecs.Positions[id]
+	if !ok {
+		return
+	}
+	index := ecs.spatialIndex()
+	index[q] = without(index[q], id)
+	delete(ecs.Positions, id)
+}
+
+// At ... entities at p in ascending order. the slice must not be modified
+func (ecs *ECS) At(p gruid.Point) (ids []int) {
+	ids = ecs.spatialIndex()[p]
+	return
+}
+
+// spatialIndex ... index of Positions by point. it is built after game is loaded
+func (ecs *ECS) spatialIndex() map[gruid.Point][]int {
+	if ecs.spatial != nil {
+		return ecs.spatial
+	}
+	ecs.spatial = map[gruid.Point][]int{}
+	for _, id := range ecs.Positions.IDs() {
+		p := ecs.Positions[id]
+		ecs.spatial[p] = append(ecs.spatial[p], id)
+	}
+	return ecs.spatial
+}
+
+// insertSorted ... new ascending ids with id. ids is kept as it is for callers of At
+func insertSorted(ids []int, id int) (inserted []int) {
+	i := sort.SearchInts(ids, id)
+	inserted = make([]int, 0, len(ids)+1)
+	inserted = append(inserted, ids[:i]...)
+	inserted = append(inserted, id)
+	inserted = append(inserted, ids[i:]...)
+	return
+}
+
+// without ... new ids except id. ids is kept as it is for callers of At
+func without(ids []int, id int) []int {
+	i := sort.SearchInts(ids, id)
+	if i < len(ids) && ids[i] == id {
+		ids = append(ids[:i:i], ids[i+1:]...)
+	}
+	return ids
+}
+
+func (ecs *ECS) MoveEntity(id int, p gruid.Point) {
+	ecs.SetPosition(id, p)
 }
 
 func (ecs *ECS) MovePlayer(p gruid.Point) {
@@ -72,8 +140,8 @@ func (ecs *ECS) PlayerPosition() (p gruid.Point) {
 }
 
 func (ecs *ECS) EnemyAt(p gruid.Point) (id int, enemy *Enemy) {
-	for i, q := range ecs.Positions {
-		if p != q || !ecs.Alive(i) {
+	for _, i := range ecs.At(p) {
+		if !ecs.Alive(i) {
 			continue
 		}
 		switch e := ecs.Entities[i].(type) {
@@ -129,8 +197,14 @@ func (ecs *ECS) GetName(i int) (name string) {
     return 
 }
 
-func (ecs *ECS) GameClear() bool {
-	return ecs.Bodies >= domain.EnemyNumber
+// BossDefeated ... the boss in this ECS is dead
+func (ecs *ECS) BossDefeated() bool {
+	for _, i := range ecs.AI.IDs() {
+		if ecs.AI[i].Boss && ecs.Dead(i) {
+			return true
+		}
+	}
+	return false
 }
 
 // RenderOrder ... Priority of rendering
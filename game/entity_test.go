@@ -3,7 +3,7 @@ package game
 import "testing"
 
 func TestItemStyle(t *testing.T) {
-	g := NewGame()
+	g := NewGame(1)
 	for i := range g.ECS.Positions{
 		e := g.ECS.Entities[i]
 		switch e.(type) {
@@ -3,10 +3,13 @@ package game
 import (
 	"errors"
 	"fmt"
+	"math/rand"
+	"strings"
 
 	"golang.org/x/text/cases"
 	"golang.org/x/text/language"
 
+	"compiler"
 	"domain"
 
 	"github.com/anaseto/gruid"
@@ -20,25 +23,47 @@ type Game struct {
 	Map  *GameMap
 	PR   *paths.PathRange
 	Logs []LogEntry
+	// Pending ... magics which take effect in later turns
+	Pending []PendingMagic
+	// Depth ... level which the player is in. 1 is the top and domain.MaxDepth is the bottom
+	Depth int
+	// Levels ... levels which the player left, keyed by depth. they are kept as they were left
+	Levels map[int]*Level
+	// Seed ... seed which the game started with. same seed makes the same game
+	Seed int64
+	// RNG ... every random number of game is drawn from it
+	RNG *RNG
+
+	rand *rand.Rand
 }
 
-func NewGame() (g *Game) {
-	g = &Game{}
+// startingWords ... keywords which the player knows at start. the others are learned from keyword scrolls
+var startingWords = []string{"gandr", "nearest-enemy", "player-x", "player-y", "circle", "physical"}
+
+// NewGame ... game made by random numbers seeded by seed
+func NewGame(seed int64) (g *Game) {
+	g = &Game{Seed: seed, RNG: NewRNG(seed), Depth: 1, Levels: map[int]*Level{}}
 
 	// init map
 	size := gruid.Point{X: domain.MapWidth, Y: domain.MapHight}
-	g.Map = NewMap(size)
+	g.Map = NewMap(size, g.Rand())
+	g.Map.PlaceStairs(g.Depth, g.Rand())
 	g.PR = paths.NewPathRange(gruid.NewRange(0, 0, size.X, size.Y))
 	g.ECS = NewEcs()
 
 	// init player
-	g.ECS.PlayerID = g.ECS.AddEntity(NewPlayer(), g.Map.RandFloor())
+	g.ECS.PlayerID = g.ECS.AddEntity(NewPlayer(), g.Map.RandFloor(g.Rand()))
 	g.ECS.Statuses[g.ECS.PlayerID] = &Status{
 		HP: 30, MaxHP: 30, Power: 5, Defence: 2,
+		Mana: 20, MaxMana: 20, ManaRegen: 1,
 	}
 	g.ECS.Styles[g.ECS.PlayerID] = Style{Rune: '@', Color: domain.ColorPlayer}
 	g.ECS.Name[g.ECS.PlayerID] = domain.PlayerName
 	g.ECS.Inventories[g.ECS.PlayerID] = &Inventory{}
+	g.ECS.Vocabularies[g.ECS.PlayerID] = Vocabulary{}
+	for _, word := range startingWords {
+		g.ECS.Vocabularies[g.ECS.PlayerID].Learn(word)
+	}
 
 	g.UpdateFOV()
 
@@ -70,7 +95,8 @@ func (g *Game) Bump(to gruid.Point) {
 func (g *Game) EndTurn() {
 	g.UpdateFOV()
 	bodies := 0
-	for i, e := range g.ECS.Entities {
+	for _, i := range g.ECS.Entities.IDs() {
+		e := g.ECS.Entities[i]
 		if g.ECS.Dead(i) {
 			bodies++
 		}
@@ -80,13 +106,18 @@ func (g *Game) EndTurn() {
 		switch e.(type) {
 		case *Enemy:
 			g.HandleMonsterTurn(i)
+			if st, ok := g.ECS.Statuses[i]; ok && g.ECS.Alive(i) {
+				st.RegenMana()
+			}
 		case *Player:
-			isHeal := g.Map.rand.Intn(100) < domain.HealRate
+			isHeal := g.Rand().Intn(100) < domain.HealRate
 			if isHeal {
 				g.ECS.Statuses[i].Heal(2)
 			}
+			g.ECS.Statuses[i].RegenMana()
 		}
 	}
+	g.tickPending()
 	g.ECS.Bodies = bodies
 }
 
@@ -118,48 +149,108 @@ func (g *Game) InFOV(p gruid.Point) bool {
 	return g.ECS.Player().FOV.Visible(p) && paths.DistanceManhattan(playerPosition, p) <= domain.MaxLOS
 }
 
+// shamanSpells ... spells which orc shamans cast at the player in order of preference
+var shamanSpells = []string{
+	"(lightning (gandr (nearest-enemy)))",
+	"(frost (gandr (nearest-enemy)))",
+}
+
+// bossSpells ... spells which the boss casts at the player in order of preference
+var bossSpells = []string{
+	"(fire (cross (gandr (nearest-enemy))))",
+	"(lightning (gandr (nearest-enemy)))",
+}
+
+const (
+	orc = iota
+	shaman
+	troll
+	boss
+)
+
+// SpawnEnemies ... add enemies to current level. deeper levels have more and stronger enemies and the bottom has the boss
 func (g *Game) SpawnEnemies() {
-	const numberOfEnemies = domain.EnemyNumber
+	numberOfEnemies := domain.EnemyNumber + (g.Depth-1)*domain.EnemiesPerDepth
+	// odds of orcs fall and those of shamans and trolls rise by depth
+	orcOdds := 70 - 15*(g.Depth-1)
+	shamanOdds := orcOdds + 15 + 5*(g.Depth-1)
 	for i := 0; i < numberOfEnemies; i++ {
-		m := &Enemy{}
-		const (
-			orc = iota
-			troll
-		)
 		kind := orc
 
-		// orc or troll
-		switch {
-		case g.Map.rand.Intn(100) < 80:
+		// orc, orc shaman or troll
+		switch r := g.Rand().Intn(100); {
+		case r < orcOdds:
+		case r < shamanOdds:
+			kind = shaman
 		default:
 			kind = troll
 		}
-		p := g.FreeFloorTile()
-		i := g.ECS.AddEntity(m, p)
-		switch kind {
-		case orc:
-			g.ECS.Statuses[i] = &Status{
-				HP: 10, MaxHP: 10, Power: 3, Defence: 0,
-			}
-			g.ECS.Name[i] = "orc"
-			g.ECS.Styles[i] = Style{Rune: 'o', Color: domain.ColorEnemy}
-		case troll:
-			g.ECS.Statuses[i] = &Status{
-				HP: 16, MaxHP: 16, Power: 5, Defence: 1,
-			}
-			g.ECS.Name[i] = "troll"
-			g.ECS.Styles[i] = Style{Rune: 'T', Color: domain.ColorEnemy}
+		g.spawnEnemy(kind)
+	}
+	if g.Depth == domain.MaxDepth {
+		g.spawnEnemy(boss)
+	}
+}
 
+// spawnEnemy ... add an enemy of kind at free floor tile
+func (g *Game) spawnEnemy(kind int) {
+	p := g.FreeFloorTile()
+	i := g.ECS.AddEntity(&Enemy{}, p)
+	ai := &EnemyAI{}
+	switch kind {
+	case orc:
+		// orcs are burly but their hide does not stop lightning
+		g.ECS.Statuses[i] = &Status{
+			HP: 10, MaxHP: 10, Power: 3, Defence: 0,
+			Resistances: map[domain.Element]int{domain.ElementFrost: 50, domain.ElementLightning: -50},
+		}
+		g.ECS.Name[i] = "orc"
+		g.ECS.Styles[i] = Style{Rune: 'o', Color: domain.ColorEnemy}
+	case shaman:
+		// shamans are frail and keep distance to chant spells
+		g.ECS.Statuses[i] = &Status{
+			HP: 7, MaxHP: 7, Power: 2, Defence: 0,
+			Mana: 10, MaxMana: 10, ManaRegen: 1,
+			Resistances: map[domain.Element]int{domain.ElementLightning: 50},
+		}
+		g.ECS.Name[i] = "orc shaman"
+		g.ECS.Styles[i] = Style{Rune: 's', Color: domain.ColorEnemy}
+		ai.Spells = shamanSpells
+		ai.SpellRange = 6
+	case troll:
+		// trolls live in cold caves and fear fire
+		g.ECS.Statuses[i] = &Status{
+			HP: 16, MaxHP: 16, Power: 5, Defence: 1,
+			Resistances: map[domain.Element]int{domain.ElementFire: -50, domain.ElementFrost: 75, domain.ElementLightning: 25},
+		}
+		g.ECS.Name[i] = "troll"
+		g.ECS.Styles[i] = Style{Rune: 'T', Color: domain.ColorEnemy}
+	case boss:
+		// the warlord resists every element a little and chants stronger spells than shamans
+		g.ECS.Statuses[i] = &Status{
+			HP: 40, MaxHP: 40, Power: 7, Defence: 2,
+			Mana: 30, MaxMana: 30, ManaRegen: 2,
+			Resistances: map[domain.Element]int{domain.ElementFire: 25, domain.ElementFrost: 25, domain.ElementLightning: 25},
 		}
-		g.ECS.AI[i] = &EnemyAI{}
+		g.ECS.Name[i] = "orc warlord"
+		g.ECS.Styles[i] = Style{Rune: 'W', Color: domain.ColorEnemy}
+		ai.Spells = bossSpells
+		ai.SpellRange = 7
+		ai.Boss = true
 	}
+	g.ECS.AI[i] = ai
+}
+
+// GameClear ... player reached the bottom and defeated the boss
+func (g *Game) GameClear() bool {
+	return g.Depth == domain.MaxDepth && g.ECS.BossDefeated()
 }
 
 // BumpAttack ... i attacks to j
 func (g *Game) BumpAttack(i, j int) {
 	si := g.ECS.Statuses[i]
 	sj := g.ECS.Statuses[j]
-	damage := sj.Damage(si.Power)
+	damage := sj.Damage(si.Power, domain.ElementPhysical)
 	attackDesc := fmt.Sprintf("%s attacks %s", NameFormatter.String(g.ECS.Name[i]), NameFormatter.String(g.ECS.Name[j]))
 	color := domain.ColorLogEnemyAttack
 	if i == g.ECS.PlayerID {
@@ -175,32 +266,53 @@ func (g *Game) BumpAttack(i, j int) {
 func (g *Game) PlaceItems() {
 	numberOfItems := domain.ItemNumber
 	for i := 0; i < numberOfItems; i++ {
-		r := g.Map.rand.Float64()
+		r := g.Rand().Float64()
 		p := g.FreeFloorTile()
 
 		switch {
-		case r < 0.7:
+		case r < 0.6:
 			name := "portion"
 			id := g.ECS.AddEntity(&HealthPotion{Amount: domain.AmountOfHealthPortion, Name: name}, p)
 			g.ECS.Styles[id] = Style{Rune: '!', Color: domain.ColorConsumable}
 			g.ECS.Name[id] = name
-		case r < 0.9:
+		case r < 0.75:
 			name := "magic arrow scroll"
-			id := g.ECS.AddEntity(&MagicArrowScroll{Damage: domain.DamageMagicArrowScroll, Range: 5}, p)
+			id := g.ECS.AddEntity(&MagicArrowScroll{Damage: domain.DamageMagicArrowScroll, Range: 5, Element: domain.ElementLightning}, p)
 			g.ECS.Styles[id] = Style{Rune: '?', Color: domain.ColorConsumable}
 			g.ECS.Name[id] = name
-		default:
+		case r < 0.85:
 			name := "explode scroll"
-			id := g.ECS.AddEntity(&ExplodeScroll{Damage: domain.DamageExplodeScroll, Radius: 10}, p)
+			id := g.ECS.AddEntity(&ExplodeScroll{Damage: domain.DamageExplodeScroll, Radius: 10, Element: domain.ElementFire}, p)
 			g.ECS.Styles[id] = Style{Rune: '?', Color: domain.ColorConsumable}
 			g.ECS.Name[id] = name
+		default:
+			g.PlaceKeywordScroll(p)
 		}
 	}
 }
 
+// PlaceKeywordScroll ... place scroll at p which teaches a word the player does not know. nothing is placed if player knows every word
+func (g *Game) PlaceKeywordScroll(p gruid.Point) {
+	unknown := []string{}
+	vocabulary := g.ECS.Vocabularies[g.ECS.PlayerID]
+	for _, word := range compiler.LearnableWords() {
+		if !vocabulary.Knows(word) {
+			unknown = append(unknown, word)
+		}
+	}
+	if len(unknown) == 0 {
+		return
+	}
+	word := unknown[g.Rand().Intn(len(unknown))]
+	name := fmt.Sprintf("scroll of %s", word)
+	id := g.ECS.AddEntity(&KeywordScroll{Word: word}, p)
+	g.ECS.Styles[id] = Style{Rune: '?', Color: domain.ColorConsumable}
+	g.ECS.Name[id] = name
+}
+
 func (g *Game) FreeFloorTile() (point gruid.Point) {
 	for {
-		p := g.Map.RandFloor()
+		p := g.Map.RandFloor(g.Rand())
 		if g.ECS.NoBlockingEnemyAt(p) {
 			return p
 		}
@@ -221,15 +333,43 @@ func (g *Game) HandleMonsterTurn(i int) {
 	}
 	if !g.InFOV(p) {
 		if len(ai.Path) < 1 {
-			ai.Path = g.PR.AstarPath(aip, p, g.Map.RandFloor())
+			ai.Path = g.PR.AstarPath(aip, p, g.Map.RandFloor(g.Rand()))
 		}
 		g.AIMove(i)
 		return
 	}
+	// spell is cast only when walls do not stop it on the way to the player
+	if paths.DistanceManhattan(p, playerPosition) <= ai.SpellRange && g.lineOfEffect(p, playerPosition) && g.MonsterCast(i) {
+		return
+	}
 	ai.Path = g.PR.AstarPath(aip, p, playerPosition)
 	g.AIMove(i)
 }
 
+// MonsterCast ... enemy i casts the first of its spells which it can. returns false if it casts nothing
+func (g *Game) MonsterCast(i int) (cast bool) {
+	view := g.ViewFrom(i)
+	for _, source := range g.ECS.AI[i].Spells {
+		magics, err := compiler.CompileWith(source, view)
+		if err != nil {
+			continue
+		}
+		// enemy waits for mana silently instead of failing to cast
+		cost := 0
+		for _, magic := range magics {
+			cost += magic.Amount
+		}
+		if g.ECS.Statuses[i].Mana < cost {
+			continue
+		}
+		if g.CastMagic(magics) == nil {
+			cast = true
+			return
+		}
+	}
+	return
+}
+
 func (g *Game) AIMove(i int) {
 	ai := g.ECS.AI[i]
 	if len(ai.Path) > 0 && ai.Path[0] == g.ECS.Positions[i] {
@@ -264,7 +404,7 @@ func (g *Game) InventoryAdd(actor, i int) (err error) {
 	case Consumable:
 		inv := g.ECS.Inventories[actor]
 		inv.Items = append(inv.Items, i)
-		delete(g.ECS.Positions, i)
+		g.ECS.RemovePosition(i)
 		return
 	}
 	err = errors.New(domain.ErrNoShow)
@@ -276,7 +416,7 @@ func (g *Game) InventoryRemove(actor, itemID int) (err error) {
 	inv := g.ECS.Inventories[actor]
 	i := inv.Items[itemID]
 	inv.Items = inv.Items[:len(inv.Items)-1]
-	g.ECS.Positions[i] = g.ECS.PlayerPosition()
+	g.ECS.SetPosition(i, g.ECS.PlayerPosition())
 	return
 }
 
@@ -320,25 +460,58 @@ func (g *Game) TargetingRadius(actor int, itemID int) (radius int, err error) {
 	}
 }
 
-func (g *Game) CastMagic(magic domain.Magic) {
-	color := domain.ColorLogEnemyAttack
-	if magic.Actor == g.ECS.PlayerID {
-		color = domain.ColorLogPlayerAttack
+// CastMagic ... actor spends total mana of magics and casts them in order. if actor does not have enough mana, nothing is cast
+func (g *Game) CastMagic(magics []domain.Magic) (err error) {
+	if len(magics) == 0 {
+		return
+	}
+	actor := magics[0].Actor
+	cost := 0
+	names := make([]string, 0, len(magics))
+	for _, magic := range magics {
+		cost += magic.Amount
+		names = append(names, magic.Name)
+	}
+
+	actorName, ok := g.ECS.Name[actor]
+	actorStatus, hasStatus := g.ECS.Statuses[actor]
+	if !hasStatus || !actorStatus.SpendMana(cost) {
+		if ok {
+			g.Logf("%s tried to cast %s but has not enough mana", domain.ColorLogSpecial, actorName, strings.Join(names, ", "))
+		}
+		err = errors.New(domain.ErrNotEnoughMana)
+		return
 	}
-	actorName, ok := g.ECS.Name[magic.Actor]
 	if ok {
-		g.Logf("%s cast %s", color, actorName, magic.Name)
+		// magics are written together so that repeat keeps costs of its iterations
+		color := domain.ColorLogEnemyAttack
+		if actor == g.ECS.PlayerID {
+			color = domain.ColorLogPlayerAttack
+		}
+		g.Logf("%s cast %s", color, actorName, compiler.DecompileAll(magics))
 	}
-	actorPosition := g.ECS.Positions[magic.Actor]
-	target := actorPosition.Add(magic.Target)
-	for i, p := range g.ECS.Positions {
-		if g.ECS.Alive(i) && paths.DistanceManhattan(p, target) <= magic.Radius {
+	for _, magic := range magics {
+		g.castMagic(magic)
+	}
+	return
+}
+
+// castMagic ... cast a magic whose cost is already paid. delayed or persistent magic is queued
+func (g *Game) castMagic(magic domain.Magic) {
+	g.schedule(g.ECS.Positions[magic.Actor], magic)
+}
+
+// applyMagic ... magic cast from origin takes effect on entities in its area
+func (g *Game) applyMagic(origin gruid.Point, magic domain.Magic) {
+	for _, p := range g.MagicArea(origin, magic) {
+		for _, i := range g.ECS.At(p) {
+			if !g.ECS.Alive(i) {
+				continue
+			}
 			st := g.ECS.Statuses[i]
-			damage := magic.Amount
-			st.Damage(damage)
-			name, ok := g.ECS.Name[i]
-			if ok {
-				g.Logf("%s got flow of mana: %d damages", domain.ColorLogSpecial, name, damage)
+			damage := st.Damage(magic.Damage, magic.Element)
+			if name, ok := g.ECS.Name[i]; ok {
+				g.Logf("%s got flow of mana: %d %s damages", domain.ColorLogSpecial, name, damage, magic.Element)
 			}
 		}
 	}
@@ -2,7 +2,6 @@ package game
 
 import (
 	"math/rand"
-	"time"
 
 	"domain"
 
@@ -26,26 +25,24 @@ func (p *Path)Neighbors(q gruid.Point) (nbs []gruid.Point){
 
 type GameMap struct {
 	Grid rl.Grid
-	rand *rand.Rand
 	Explored map[gruid.Point]bool // explored cells
 }
 
-func NewMap(size gruid.Point) (gmap *GameMap) {
+// NewMap ... map generated by random numbers of rnd
+func NewMap(size gruid.Point, rnd *rand.Rand) (gmap *GameMap) {
 	gmap = &GameMap{
 		Grid: rl.NewGrid(size.X, size.Y),
-		rand: rand.New(rand.NewSource(time.Now().UnixNano())),
 		Explored: make(map[gruid.Point]bool),
 	}
-	gmap.Generate()
+	gmap.Generate(rnd)
 	return
 }
 
-func (gmap *GameMap)SetRand(rand *rand.Rand) {
-	gmap.rand = rand 
-}
-
 func (gmap *GameMap)IsWalkable(p gruid.Point) (isWalkable bool) {
-	isWalkable = gmap.Grid.At(p) == domain.Floor && gmap.Grid.Contains(p)
+	switch gmap.Grid.At(p) {
+	case domain.Floor, domain.StairsDown, domain.StairsUp:
+		isWalkable = gmap.Grid.Contains(p)
+	}
 	return 
 }
 
@@ -55,13 +52,17 @@ func (gmap *GameMap)Rune(c rl.Cell) (r rune){
 		r = '#'
 	case domain.Floor:
 		r = '.'
+	case domain.StairsDown:
+		r = '>'
+	case domain.StairsUp:
+		r = '<'
 	}
 	return
 }
 
 // Generate ... fills Grid attribute of gmap with a procedurally generated map
-func (gmap *GameMap)Generate() {
-	mapGen := rl.MapGen{Rand: gmap.rand, Grid: gmap.Grid}
+func (gmap *GameMap)Generate(rnd *rand.Rand) {
+	mapGen := rl.MapGen{Rand: rnd, Grid: gmap.Grid}
 	rules := []rl.CellularAutomataRule{
 		{WCutoff1: 5, WCutoff2: 2, WallsOutOfRange: true},
 		{WCutoff1: 5, WCutoff2: 25, WallsOutOfRange: true}, 
@@ -70,7 +71,7 @@ func (gmap *GameMap)Generate() {
 	for {
 		mapGen.CellularAutomataCave(domain.Wall, domain.Floor, 0.42, rules)
 
-		freep := gmap.RandFloor() // random floor cell
+		freep := gmap.RandFloor(rnd) // random floor cell
 
 		pr := paths.NewPathRange(gmap.Grid.Range())
 		pr.CCMap(&Path{Map: gmap}, freep)
@@ -83,13 +84,36 @@ func (gmap *GameMap)Generate() {
 	}
 }
 
-func (gmap *GameMap)RandFloor() gruid.Point{
+func (gmap *GameMap)RandFloor(rnd *rand.Rand) gruid.Point{
 	size := gmap.Grid.Size()
 
 	for {
-		freep := gruid.Point{X: gmap.rand.Intn(size.X), Y: gmap.rand.Intn(size.Y)}
+		freep := gruid.Point{X: rnd.Intn(size.X), Y: rnd.Intn(size.Y)}
 		if gmap.Grid.At(freep) == domain.Floor {
 			return freep
 		}
 	}
 }
+
+// PlaceStairs ... put stairs down unless depth is the bottom and stairs up unless depth is the top
+func (gmap *GameMap)PlaceStairs(depth int, rnd *rand.Rand) {
+	if depth < domain.MaxDepth {
+		gmap.Grid.Set(gmap.RandFloor(rnd), domain.StairsDown)
+	}
+	if depth > 1 {
+		gmap.Grid.Set(gmap.RandFloor(rnd), domain.StairsUp)
+	}
+}
+
+// Stairs ... position of stairs c. ok is false if map has no such stairs
+func (gmap *GameMap)Stairs(c rl.Cell) (p gruid.Point, ok bool) {
+	it := gmap.Grid.Iterator()
+	for it.Next() {
+		if it.Cell() == c {
+			p = it.P()
+			ok = true
+			return
+		}
+	}
+	return
+}
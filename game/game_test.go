@@ -0,0 +1,244 @@
+package game
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"domain"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/paths"
+)
+
+func TestCastMagicMana(t *testing.T) {
+	g := NewGame(1)
+	st := g.ECS.Statuses[g.ECS.PlayerID]
+	magic := domain.Magic{Actor: g.ECS.PlayerID, Amount: 5, Damage: 1, Name: "gandr"}
+
+	st.Mana = 4
+	if err := g.CastMagic([]domain.Magic{magic}); err == nil {
+		t.Fatal("expect error when mana is not enough")
+	}
+	if st.Mana != 4 {
+		t.Fatalf("mana is spent by refused magic: %d", st.Mana)
+	}
+
+	st.Mana = 6
+	if err := g.CastMagic([]domain.Magic{magic}); err != nil {
+		t.Fatal(err)
+	}
+	if st.Mana != 1 {
+		t.Fatalf("expect mana 1 but got %d", st.Mana)
+	}
+
+	g.EndTurn()
+	if st.Mana != 1+st.ManaRegen {
+		t.Fatalf("expect mana %d after a turn but got %d", 1+st.ManaRegen, st.Mana)
+	}
+
+	// cost of sequence is total of magics
+	st.Mana = 9
+	if err := g.CastMagic([]domain.Magic{magic, magic}); err == nil {
+		t.Fatal("expect error when mana is not enough for whole sequence")
+	}
+	st.Mana = 10
+	if err := g.CastMagic([]domain.Magic{magic, magic}); err != nil {
+		t.Fatal(err)
+	}
+	if st.Mana != 0 {
+		t.Fatalf("expect mana 0 but got %d", st.Mana)
+	}
+}
+
+// hasLog ... g logged text
+func hasLog(g *Game, text string) bool {
+	for _, e := range g.Logs {
+		if e.Text == text {
+			return true
+		}
+	}
+	return false
+}
+
+func TestStatusDamage(t *testing.T) {
+	type TestItem struct {
+		Element domain.Element
+		Damage int
+		ExpectedHP int
+	}
+	table := map[string]TestItem{
+		"defence cuts physical": {
+			Element: domain.ElementPhysical,
+			Damage: 6,
+			ExpectedHP: 16,
+		},
+		"vulnerable": {
+			Element: domain.ElementFire,
+			Damage: 6,
+			ExpectedHP: 11,
+		},
+		"resistant": {
+			Element: domain.ElementFrost,
+			Damage: 6,
+			ExpectedHP: 19,
+		},
+		"immune": {
+			Element: domain.ElementLightning,
+			Damage: 6,
+			ExpectedHP: 20,
+		},
+		"defence does not heal": {
+			Element: domain.ElementPhysical,
+			Damage: 1,
+			ExpectedHP: 20,
+		},
+	}
+
+	for key, item := range table {
+		st := &Status{
+			HP: 20, MaxHP: 20, Defence: 2,
+			Resistances: map[domain.Element]int{domain.ElementFire: -50, domain.ElementFrost: 75, domain.ElementLightning: 100},
+		}
+		st.Damage(item.Damage, item.Element)
+		if st.HP != item.ExpectedHP {
+			t.Errorf("%s: expect hp %d but got %d", key, item.ExpectedHP, st.HP)
+		}
+	}
+}
+
+func TestEnemyResistances(t *testing.T) {
+	g := NewGame(1)
+	profiles := map[string]map[domain.Element]int{}
+	for i, name := range g.ECS.Name {
+		if _, ok := g.ECS.Entities[i].(*Enemy); ok {
+			profiles[name] = g.ECS.Statuses[i].Resistances
+		}
+	}
+	orc, troll := profiles["orc"], profiles["troll"]
+	if orc == nil || troll == nil {
+		t.Skip("map has only one kind of enemy")
+	}
+	if orc[domain.ElementFire] <= troll[domain.ElementFire] || orc[domain.ElementLightning] >= troll[domain.ElementLightning] {
+		t.Fatalf("orc and troll should differ: %v %v", orc, troll)
+	}
+}
+
+// addShaman ... put orc shaman with mana where it can cast at the player. ok is false if there is no such floor
+func addShaman(g *Game, mana int) (id int, ok bool) {
+	pp := g.ECS.PlayerPosition()
+	g.Map.Grid.Range().Iter(func(p gruid.Point) {
+		dist := paths.DistanceManhattan(pp, p)
+		if ok || dist < 2 || dist > 6 || !g.Map.IsWalkable(p) || !g.InFOV(p) || !g.ECS.NoBlockingEnemyAt(p) || !g.lineOfEffect(p, pp) {
+			return
+		}
+		id = g.ECS.AddEntity(&Enemy{}, p)
+		g.ECS.Statuses[id] = &Status{HP: 7, MaxHP: 7, Mana: mana, MaxMana: 10}
+		g.ECS.Name[id] = "orc shaman"
+		g.ECS.AI[id] = &EnemyAI{Spells: shamanSpells, SpellRange: 6}
+		ok = true
+	})
+	return
+}
+
+func TestMonsterCast(t *testing.T) {
+	g := NewGame(1)
+	id, ok := addShaman(g, 10)
+	if !ok {
+		t.Skip("player sees no floor to put shaman")
+	}
+	player := g.ECS.Statuses[g.ECS.PlayerID]
+	hp := player.HP
+	g.HandleMonsterTurn(id)
+
+	if player.HP >= hp {
+		t.Fatalf("shaman did not hurt player: hp %d", player.HP)
+	}
+	if g.ECS.Statuses[id].Mana != 5 {
+		t.Fatalf("expect mana 5 but got %d", g.ECS.Statuses[id].Mana)
+	}
+	d := g.ECS.PlayerPosition().Sub(g.ECS.Positions[id])
+	cast := fmt.Sprintf("orc shaman cast (lightning (gandr %d %d))", d.X, d.Y)
+	if !hasLog(g, cast) {
+		t.Fatalf("expect log %q", cast)
+	}
+}
+
+func TestMonsterCastWithoutMana(t *testing.T) {
+	g := NewGame(1)
+	id, ok := addShaman(g, 0)
+	if !ok {
+		t.Skip("player sees no floor to put shaman")
+	}
+	if g.MonsterCast(id) {
+		t.Fatal("shaman cast without mana")
+	}
+	for _, e := range g.Logs {
+		if strings.Contains(e.Text, "not enough mana") {
+			t.Fatalf("unexpected log %q", e.Text)
+		}
+	}
+}
+
+func TestPendingMagic(t *testing.T) {
+	g := NewGame(1)
+	st := g.ECS.Statuses[g.ECS.PlayerID]
+	pp := g.ECS.PlayerPosition()
+	magic := domain.Magic{Actor: g.ECS.PlayerID, Amount: 1, Damage: 3, Element: domain.ElementFire, Delay: 2, Duration: 1, Name: "gandr"}
+	if err := g.CastMagic([]domain.Magic{magic}); err != nil {
+		t.Fatal(err)
+	}
+	if turns, ok := g.PendingArea()[pp]; !ok || turns != 2 {
+		t.Fatalf("expect pending area at %v in 2 turns but got %d, %v", pp, turns, ok)
+	}
+
+	// delayed 2 turns and persists 1 turn more
+	expectedHP := []int{st.HP, st.HP, st.HP - 3, st.HP - 6, st.HP - 6}
+	for turn, hp := range expectedHP {
+		if st.HP != hp {
+			t.Fatalf("turn %d: expect hp %d but got %d", turn, hp, st.HP)
+		}
+		g.tickPending()
+	}
+	if len(g.Pending) != 0 {
+		t.Fatalf("expect no pending magic but got %v", g.Pending)
+	}
+}
+
+func TestKeywordScroll(t *testing.T) {
+	g := NewGame(1)
+	view := g.ViewFrom(g.ECS.PlayerID)
+	if !view.Knows("gandr") || view.Knows("fire") {
+		t.Fatal("expect player knows only starting words")
+	}
+	scroll := &KeywordScroll{Word: "fire"}
+	if err := scroll.Activate(g, ItemAction{Actor: g.ECS.PlayerID}); err != nil {
+		t.Fatal(err)
+	}
+	if !view.Knows("fire") {
+		t.Fatal("expect player learned fire")
+	}
+	if err := scroll.Activate(g, ItemAction{Actor: g.ECS.PlayerID}); err == nil {
+		t.Fatal("expect error when the word is already known")
+	}
+
+	// enemies have no vocabulary and know every word
+	id := g.ECS.AddEntity(&Enemy{}, g.FreeFloorTile())
+	if !g.ViewFrom(id).Knows("lightning") {
+		t.Fatal("expect enemy knows every word")
+	}
+}
+
+func TestPlaceKeywordScroll(t *testing.T) {
+	g := NewGame(1)
+	p := g.FreeFloorTile()
+	g.PlaceKeywordScroll(p)
+	id := g.ECS.NextID - 1
+	scroll, ok := g.ECS.Entities[id].(*KeywordScroll)
+	if !ok || g.ECS.Positions[id] != p {
+		t.Fatal("expect keyword scroll is placed")
+	}
+	if g.ECS.Vocabularies[g.ECS.PlayerID].Knows(scroll.Word) {
+		t.Fatalf("expect scroll teaches unknown word but got %s", scroll.Word)
+	}
+}
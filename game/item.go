@@ -51,13 +51,14 @@ func (p *HealthPotion) Activate(g *Game, a ItemAction) (err error) {
 type MagicArrowScroll struct {
     Damage int
     Range int 
+    Element domain.Element // element of the arrow
 }
 
 //
 func (ms *MagicArrowScroll) Activate(g *Game, a ItemAction) (err error) {
     targetID := -1
     minDist := ms.Range + 1 
-    for i := range g.ECS.Statuses {
+    for _, i := range Query(g.ECS.Statuses, g.ECS.Positions) {
         pos := g.ECS.Positions[i]
         if a.Actor == i || g.ECS.Dead(i) || !g.InFOV(pos) {
             continue
@@ -75,16 +76,36 @@ func (ms *MagicArrowScroll) Activate(g *Game, a ItemAction) (err error) {
     st, ok := g.ECS.Statuses[targetID]
     if ok {
         g.Logf("a magic lightning strikes %v", domain.ColorStatusHealthy, g.ECS.Name[targetID])
-        st.Damage(ms.Damage)
+        st.Damage(ms.Damage, ms.Element)
     } else {
         log.Fatalf("could not find status of %d", targetID)
     }
     return 
 }
 
+// KeywordScroll ... scroll which teaches a keyword of spell to the reader
+type KeywordScroll struct {
+    Word string
+}
+
+func (ks *KeywordScroll) Activate(g *Game, a ItemAction) (err error) {
+    vocabulary, ok := g.ECS.Vocabularies[a.Actor]
+    if !ok {
+        err = fmt.Errorf("%s cannot read the scroll", g.ECS.Name[a.Actor])
+        return
+    }
+    if !vocabulary.Learn(ks.Word) {
+        err = fmt.Errorf("you already know %s", ks.Word)
+        return
+    }
+    g.Logf("You learned a word of spell: %s", domain.ColorLogSpecial, ks.Word)
+    return
+}
+
 type ExplodeScroll struct {
     Damage int 
     Radius int 
+    Element domain.Element // element of the explosion
 }
 
 func (es *ExplodeScroll) Activate(g *Game, a ItemAction) (err error) {
@@ -98,13 +119,14 @@ func (es *ExplodeScroll) Activate(g *Game, a ItemAction) (err error) {
         return 
     }
     hit := 0
-    for i, st := range g.ECS.Statuses {
+    for _, i := range Query(g.ECS.Statuses, g.ECS.Positions) {
+        st := g.ECS.Statuses[i]
         q := g.ECS.Positions[i]
         if q == g.ECS.PlayerPosition() || g.ECS.Dead(i) {
             continue
         }
         g.Logf("%v is engulfed in vortex of mana", domain.ColorStatusHealthy, g.ECS.GetName(i))
-        st.Damage(es.Damage)
+        st.Damage(es.Damage, es.Element)
         hit++
     }
     if hit == 0{
@@ -0,0 +1,123 @@
+package game
+
+import (
+	"errors"
+
+	"domain"
+
+	"github.com/anaseto/gruid"
+	"github.com/anaseto/gruid/paths"
+	"github.com/anaseto/gruid/rl"
+)
+
+// Level ... map and entities of a level which the player left
+type Level struct {
+	Map     *GameMap
+	ECS     *ECS
+	Pending []PendingMagic
+}
+
+// Descend ... player goes down the stairs under the player to the next level
+func (g *Game) Descend() (err error) {
+	if g.Map.Grid.At(g.ECS.PlayerPosition()) != domain.StairsDown {
+		err = errors.New("there are no stairs down here")
+		return
+	}
+	g.changeLevel(g.Depth+1, domain.StairsUp)
+	g.Logf("You descend to depth %d", domain.ColorLogSpecial, g.Depth)
+	g.EndTurn()
+	return
+}
+
+// Ascend ... player goes up the stairs under the player to the previous level
+func (g *Game) Ascend() (err error) {
+	if g.Map.Grid.At(g.ECS.PlayerPosition()) != domain.StairsUp {
+		err = errors.New("there are no stairs up here")
+		return
+	}
+	g.changeLevel(g.Depth-1, domain.StairsDown)
+	g.Logf("You ascend to depth %d", domain.ColorLogSpecial, g.Depth)
+	g.EndTurn()
+	return
+}
+
+// changeLevel ... keep current level and bring the player with inventory to stairs arrival of level at depth, or next to them if an enemy stands on them. the level is generated at first visit
+func (g *Game) changeLevel(depth int, arrival rl.Cell) {
+	if g.Levels == nil {
+		g.Levels = map[int]*Level{}
+	}
+	from := g.ECS
+	g.Levels[g.Depth] = &Level{Map: g.Map, ECS: g.ECS, Pending: g.Pending}
+	g.Depth = depth
+
+	level, visited := g.Levels[depth]
+	delete(g.Levels, depth)
+	if visited {
+		g.Map, g.ECS, g.Pending = level.Map, level.ECS, level.Pending
+	} else {
+		g.Map = NewMap(g.Map.Grid.Size(), g.Rand())
+		g.Map.PlaceStairs(depth, g.Rand())
+		g.ECS = NewEcs()
+		g.Pending = nil
+	}
+
+	from.Transfer(g.ECS, from.PlayerID, g.arrivalPosition(arrival))
+	g.ECS.PlayerID = from.PlayerID
+
+	if !visited {
+		g.SpawnEnemies()
+		g.PlaceItems()
+	}
+}
+
+// arrivalPosition ... stairs arrival of current level, or the nearest walkable cell from them which no enemy stands on
+func (g *Game) arrivalPosition(arrival rl.Cell) (p gruid.Point) {
+	stairs, _ := g.Map.Stairs(arrival)
+	nbs := paths.Neighbors{}
+	seen := map[gruid.Point]bool{stairs: true}
+	queue := []gruid.Point{stairs}
+	for len(queue) > 0 {
+		p, queue = queue[0], queue[1:]
+		if i, _ := g.ECS.EnemyAt(p); !g.ECS.Alive(i) {
+			return
+		}
+		for _, q := range nbs.All(p, g.Map.IsWalkable) {
+			if !seen[q] {
+				seen[q] = true
+				queue = append(queue, q)
+			}
+		}
+	}
+	p = stairs
+	return
+}
+
+// Transfer ... move entity id and items in its inventory to other keeping their ids. id is put at p
+func (ecs *ECS) Transfer(other *ECS, id int, p gruid.Point) {
+	// ids are unique in every level because NextID of current level is always the largest
+	if other.NextID < ecs.NextID {
+		other.NextID = ecs.NextID
+	}
+	ids := []int{id}
+	if inv, ok := ecs.Inventories[id]; ok {
+		ids = append(ids, inv.Items...)
+	}
+	for _, i := range ids {
+		other.Entities[i] = ecs.Entities[i]
+		moveComponent(ecs.Statuses, other.Statuses, i)
+		moveComponent(ecs.AI, other.AI, i)
+		moveComponent(ecs.Name, other.Name, i)
+		moveComponent(ecs.Styles, other.Styles, i)
+		moveComponent(ecs.Inventories, other.Inventories, i)
+		moveComponent(ecs.Vocabularies, other.Vocabularies, i)
+		ecs.RemoveEntity(i)
+	}
+	other.SetPosition(id, p)
+}
+
+// moveComponent ... copy component of id from one store to another. it is deleted from the former by RemoveEntity
+func moveComponent[T any](from, to Store[T], id int) {
+	if c, ok := from[id]; ok {
+		to[id] = c
+	}
+}
@@ -0,0 +1,148 @@
+package game
+
+import (
+	"testing"
+
+	"domain"
+
+	"github.com/anaseto/gruid/rl"
+)
+
+// toStairs ... move the player onto stairs c of current level
+func toStairs(t *testing.T, g *Game, c rl.Cell) {
+	p, ok := g.Map.Stairs(c)
+	if !ok {
+		t.Fatalf("no stairs %d at depth %d", c, g.Depth)
+	}
+	g.ECS.MovePlayer(p)
+}
+
+func TestDescendAndAscend(t *testing.T) {
+	g := NewGame(1)
+	pid := g.ECS.PlayerID
+	st := g.ECS.Statuses[pid]
+	st.HP, st.MaxHP = 1000, 1000
+	if _, ok := g.Map.Stairs(domain.StairsUp); ok {
+		t.Fatal("expect no stairs up at the top")
+	}
+	if err := g.Descend(); err == nil {
+		t.Fatal("expect error when player is not on stairs")
+	}
+
+	potion := g.ECS.AddEntity(&HealthPotion{Amount: 5, Name: "portion"}, g.ECS.PlayerPosition())
+	if err := g.InventoryAdd(pid, potion); err != nil {
+		t.Fatal(err)
+	}
+	g.ECS.Vocabularies[pid].Learn("fire")
+	top := g.ECS
+
+	toStairs(t, g, domain.StairsDown)
+	if err := g.Descend(); err != nil {
+		t.Fatal(err)
+	}
+	if g.Depth != 2 || g.Levels[1] == nil || g.Levels[1].ECS != top {
+		t.Fatalf("expect depth 2 keeping the top level but got depth %d", g.Depth)
+	}
+	if g.Map.Grid.At(g.ECS.PlayerPosition()) != domain.StairsUp {
+		t.Fatal("expect player arrives on stairs up")
+	}
+	if g.ECS.Statuses[pid] != st || !g.ECS.Vocabularies[pid].Knows("fire") {
+		t.Fatal("expect player keeps status and vocabulary")
+	}
+	if inv := g.ECS.Inventories[pid]; len(inv.Items) != 1 || g.ECS.Entities[inv.Items[0]] == nil {
+		t.Fatal("expect player keeps inventory")
+	}
+	if _, ok := top.Entities[pid]; ok {
+		t.Fatal("expect player leaves the top level")
+	}
+	for _, id := range g.ECS.Entities.IDs() {
+		if _, ok := top.Entities[id]; ok {
+			t.Fatalf("expect ids unique in every level but %d is in both", id)
+		}
+	}
+	if n := len(g.ECS.AI); n != domain.EnemyNumber+domain.EnemiesPerDepth {
+		t.Fatalf("expect %d enemies at depth 2 but got %d", domain.EnemyNumber+domain.EnemiesPerDepth, n)
+	}
+
+	second := g.ECS
+	if err := g.Ascend(); err != nil {
+		t.Fatal(err)
+	}
+	if g.Depth != 1 || g.ECS != top || g.Levels[2].ECS != second {
+		t.Fatal("expect the top level as it was left")
+	}
+	if g.Map.Grid.At(g.ECS.PlayerPosition()) != domain.StairsDown {
+		t.Fatal("expect player arrives on stairs down")
+	}
+	if err := g.Ascend(); err == nil {
+		t.Fatal("expect error when player is not on stairs up")
+	}
+
+	if err := g.Descend(); err != nil {
+		t.Fatal(err)
+	}
+	if g.ECS != second {
+		t.Fatal("expect the second level is not generated again")
+	}
+}
+
+func TestArrivalOccupied(t *testing.T) {
+	g := NewGame(1)
+	st := g.ECS.Statuses[g.ECS.PlayerID]
+	st.HP, st.MaxHP = 1000, 1000
+	stairs, _ := g.Map.Stairs(domain.StairsDown)
+	enemy := g.ECS.AddEntity(&Enemy{}, stairs)
+	g.ECS.Statuses[enemy] = &Status{HP: 10, MaxHP: 10}
+	top := g.ECS
+
+	toStairs(t, g, domain.StairsDown)
+	if err := g.Descend(); err != nil {
+		t.Fatal(err)
+	}
+	// level is changed without a turn so that the enemy does not move
+	g.changeLevel(g.Depth-1, domain.StairsDown)
+	if g.ECS != top || g.ECS.Positions[enemy] != stairs {
+		t.Fatal("expect the enemy stays on stairs down")
+	}
+	p := g.ECS.PlayerPosition()
+	if d := p.Sub(stairs); p == stairs || d.X < -1 || d.X > 1 || d.Y < -1 || d.Y > 1 || !g.Map.IsWalkable(p) {
+		t.Fatalf("expect player arrives next to stairs %v but got %v", stairs, p)
+	}
+}
+
+func TestGameClear(t *testing.T) {
+	g := NewGame(3)
+	st := g.ECS.Statuses[g.ECS.PlayerID]
+	st.HP, st.MaxHP = 1000, 1000
+	for g.Depth < domain.MaxDepth {
+		for _, i := range g.ECS.AI.IDs() {
+			if g.ECS.AI[i].Boss {
+				t.Fatalf("expect no boss at depth %d", g.Depth)
+			}
+		}
+		toStairs(t, g, domain.StairsDown)
+		if err := g.Descend(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, ok := g.Map.Stairs(domain.StairsDown); ok {
+		t.Fatal("expect no stairs down at the bottom")
+	}
+
+	boss := -1
+	for _, i := range g.ECS.AI.IDs() {
+		if g.ECS.AI[i].Boss {
+			boss = i
+		}
+	}
+	if boss < 0 {
+		t.Fatal("expect boss at the bottom")
+	}
+	if g.GameClear() {
+		t.Fatal("expect game is not clear while boss is alive")
+	}
+	g.ECS.Statuses[boss].HP = 0
+	if !g.GameClear() {
+		t.Fatal("expect game clear after boss is defeated")
+	}
+}
@@ -0,0 +1,67 @@
+package game
+
+import (
+	"domain"
+
+	"github.com/anaseto/gruid"
+)
+
+// PendingMagic ... magic which takes effect in later turns. it is saved with game
+type PendingMagic struct {
+	Magic domain.Magic
+	// Origin ... position of the caster when the magic was cast. area of the magic does not follow the caster
+	Origin gruid.Point
+	// Turns ... turns until the magic takes effect next
+	Turns int
+	// Remaining ... times the magic takes effect yet
+	Remaining int
+}
+
+// schedule ... queue magic cast from origin by its delay and duration. magic without delay takes effect now
+func (g *Game) schedule(origin gruid.Point, magic domain.Magic) {
+	remaining := magic.Duration + 1
+	if magic.Delay == 0 {
+		g.applyMagic(origin, magic)
+		remaining--
+	}
+	if remaining <= 0 {
+		return
+	}
+	turns := magic.Delay
+	if turns == 0 {
+		turns = 1
+	}
+	g.Pending = append(g.Pending, PendingMagic{Magic: magic, Origin: origin, Turns: turns, Remaining: remaining})
+}
+
+// tickPending ... count down pending magics and apply those whose turn comes
+func (g *Game) tickPending() {
+	pending := make([]PendingMagic, 0, len(g.Pending))
+	for _, p := range g.Pending {
+		p.Turns--
+		if p.Turns > 0 {
+			pending = append(pending, p)
+			continue
+		}
+		g.applyMagic(p.Origin, p.Magic)
+		p.Remaining--
+		if p.Remaining > 0 {
+			p.Turns = 1
+			pending = append(pending, p)
+		}
+	}
+	g.Pending = pending
+}
+
+// PendingArea ... cells which pending magics will affect and turns until the earliest of them
+func (g *Game) PendingArea() (area map[gruid.Point]int) {
+	area = map[gruid.Point]int{}
+	for _, p := range g.Pending {
+		for _, q := range g.MagicArea(p.Origin, p.Magic) {
+			if turns, ok := area[q]; !ok || p.Turns < turns {
+				area[q] = p.Turns
+			}
+		}
+	}
+	return
+}
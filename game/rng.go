@@ -0,0 +1,48 @@
+package game
+
+import (
+	"math/rand"
+)
+
+// RNG ... source of every random number of game. its state is exported so that a saved game
+// draws the same numbers after it is loaded. it implements rand.Source64 by splitmix64
+type RNG struct {
+	State uint64
+}
+
+var _ rand.Source64 = new(RNG)
+
+// NewRNG ... RNG seeded by seed
+func NewRNG(seed int64) (r *RNG) {
+	r = &RNG{}
+	r.Seed(seed)
+	return
+}
+
+func (r *RNG) Seed(seed int64) {
+	r.State = uint64(seed)
+}
+
+func (r *RNG) Uint64() uint64 {
+	r.State += 0x9e3779b97f4a7c15
+	z := r.State
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func (r *RNG) Int63() int64 {
+	return int64(r.Uint64() >> 1)
+}
+
+// Rand ... random numbers of game drawn from RNG. it is made again from RNG after game is loaded.
+// game saved without RNG gets RNG of its seed
+func (g *Game) Rand() *rand.Rand {
+	if g.RNG == nil {
+		g.RNG = NewRNG(g.Seed)
+	}
+	if g.rand == nil {
+		g.rand = rand.New(g.RNG)
+	}
+	return g.rand
+}
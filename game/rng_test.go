@@ -0,0 +1,47 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestRNG(t *testing.T) {
+	a, b := NewRNG(5), NewRNG(5)
+	for i := 0; i < 10; i++ {
+		if x, y := a.Uint64(), b.Uint64(); x != y {
+			t.Fatalf("expect same number from same seed but got %d and %d", x, y)
+		}
+	}
+	if NewRNG(5).Int63() == NewRNG(6).Int63() {
+		t.Fatal("expect different number from different seed")
+	}
+	if n := NewRNG(5).Int63(); n < 0 {
+		t.Fatalf("expect non-negative Int63 but got %d", n)
+	}
+}
+
+// playTurns ... player waits for n turns
+func playTurns(g *Game, n int) {
+	for i := 0; i < n && !g.ECS.PlayerDead(); i++ {
+		g.EndTurn()
+	}
+}
+
+func TestNewGameSeed(t *testing.T) {
+	g1, g2 := NewGame(42), NewGame(42)
+	if !reflect.DeepEqual(g1.Map.Grid, g2.Map.Grid) {
+		t.Fatal("expect same map from same seed")
+	}
+	playTurns(g1, 30)
+	playTurns(g2, 30)
+	if !reflect.DeepEqual(g1.ECS.Positions, g2.ECS.Positions) {
+		t.Fatal("expect same positions after same turns")
+	}
+	if g1.ECS.Statuses[g1.ECS.PlayerID].HP != g2.ECS.Statuses[g2.ECS.PlayerID].HP || g1.RNG.State != g2.RNG.State {
+		t.Fatal("expect same game after same turns")
+	}
+
+	if reflect.DeepEqual(g1.Map.Grid, NewGame(43).Map.Grid) {
+		t.Fatal("expect different map from different seed")
+	}
+}
@@ -0,0 +1,64 @@
+package game
+
+import (
+	"sort"
+)
+
+// Store ... component of entities keyed by entity id. it stays a map so that games saved before decode into it
+type Store[T any] map[int]T
+
+// Has ... entity id has the component
+func (s Store[T]) Has(id int) bool {
+	_, ok := s[id]
+	return ok
+}
+
+// Len ... number of entities which have the component
+func (s Store[T]) Len() int {
+	return len(s)
+}
+
+// IDs ... entities which have the component in ascending order
+func (s Store[T]) IDs() (ids []int) {
+	ids = make([]int, 0, len(s))
+	for id := range s {
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return
+}
+
+// ComponentStore ... store of any type of component. Query combines them
+type ComponentStore interface {
+	Has(id int) bool
+	Len() int
+	IDs() []int
+}
+
+// Query ... entities which have every component of stores in ascending order. only the smallest store is scanned
+func Query(stores ...ComponentStore) (ids []int) {
+	if len(stores) == 0 {
+		return
+	}
+	smallest := stores[0]
+	for _, s := range stores[1:] {
+		if s.Len() < smallest.Len() {
+			smallest = s
+		}
+	}
+	for _, id := range smallest.IDs() {
+		if hasAll(id, stores) {
+			ids = append(ids, id)
+		}
+	}
+	return
+}
+
+func hasAll(id int, stores []ComponentStore) bool {
+	for _, s := range stores {
+		if !s.Has(id) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,67 @@
+package game
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/anaseto/gruid"
+)
+
+func TestQuery(t *testing.T) {
+	positions := Store[gruid.Point]{3: {}, 1: {}, 2: {}, 7: {}}
+	statuses := Store[*Status]{2: {}, 3: {}, 9: {}}
+	ai := Store[*EnemyAI]{3: {}, 2: {}, 5: {}}
+
+	if ids := positions.IDs(); !reflect.DeepEqual([]int{1, 2, 3, 7}, ids) {
+		t.Fatalf("expect ids in ascending order but got %v", ids)
+	}
+	if ids := Query(positions, statuses, ai); !reflect.DeepEqual([]int{2, 3}, ids) {
+		t.Fatalf("expect entities with every component but got %v", ids)
+	}
+	if ids := Query(positions, Store[string]{}); len(ids) != 0 {
+		t.Fatalf("expect no entity but got %v", ids)
+	}
+	if ids := Query(); len(ids) != 0 {
+		t.Fatalf("expect no entity but got %v", ids)
+	}
+}
+
+func TestSpatialIndex(t *testing.T) {
+	ecs := NewEcs()
+	p, q := gruid.Point{X: 1, Y: 1}, gruid.Point{X: 2, Y: 1}
+	a := ecs.AddEntity(&Enemy{}, p)
+	b := ecs.AddEntity(&HealthPotion{}, q)
+	c := ecs.AddEntity(&Enemy{}, p)
+	ecs.Statuses[a] = &Status{HP: 1}
+	ecs.Statuses[c] = &Status{HP: 1}
+
+	if ids := ecs.At(p); !reflect.DeepEqual([]int{a, c}, ids) {
+		t.Fatalf("expect %v at %v but got %v", []int{a, c}, p, ids)
+	}
+	at := ecs.At(p)
+	ecs.MoveEntity(a, q)
+	if ids := ecs.At(q); !reflect.DeepEqual([]int{a, b}, ids) {
+		t.Fatalf("expect %v at %v but got %v", []int{a, b}, q, ids)
+	}
+	if !reflect.DeepEqual([]int{a, c}, at) {
+		t.Fatalf("slice returned by At is changed by move: %v", at)
+	}
+	if id, _ := ecs.EnemyAt(q); id != a {
+		t.Fatalf("expect enemy %d at %v but got %d", a, q, id)
+	}
+
+	ecs.RemovePosition(b)
+	ecs.RemoveEntity(c)
+	if ids := ecs.At(p); len(ids) != 0 {
+		t.Fatalf("expect nobody at %v but got %v", p, ids)
+	}
+	if ecs.Positions.Has(b) {
+		t.Fatal("expect position of picked item is removed")
+	}
+
+	// index is built again from positions, e.g. after the game is loaded
+	ecs.spatial = nil
+	if ids := ecs.At(q); !reflect.DeepEqual([]int{a}, ids) {
+		t.Fatalf("expect %v at %v but got %v", []int{a}, q, ids)
+	}
+}
@@ -0,0 +1,79 @@
+package game
+
+import (
+	"github.com/anaseto/gruid"
+)
+
+// CasterView ... read-only view of game from a caster of spell. it is what spells query at cast time
+type CasterView struct {
+	g      *Game
+	caster int
+}
+
+// ViewFrom ... view of game from entity caster
+func (g *Game) ViewFrom(caster int) (view CasterView) {
+	view = CasterView{g: g, caster: caster}
+	return
+}
+
+// Caster ... entity id of the caster
+func (v CasterView) Caster() int {
+	return v.caster
+}
+
+// CasterPosition ... position of the caster on map
+func (v CasterView) CasterPosition() gruid.Point {
+	return v.g.ECS.Positions[v.caster]
+}
+
+// PlayerPosition ... position of the player on map
+func (v CasterView) PlayerPosition() gruid.Point {
+	return v.g.ECS.PlayerPosition()
+}
+
+// Hostiles ... positions of living hostile entities the caster can see.
+// for the player they are enemies in fov, for enemies it is the player if the enemy is in fov of the player
+func (v CasterView) Hostiles() (hostiles []gruid.Point) {
+	ecs := v.g.ECS
+	if v.caster != ecs.PlayerID {
+		if ecs.Alive(ecs.PlayerID) && v.sees(ecs.PlayerPosition()) {
+			hostiles = append(hostiles, ecs.PlayerPosition())
+		}
+		return
+	}
+	for _, i := range Query(ecs.Entities, ecs.Positions, ecs.Statuses) {
+		p := ecs.Positions[i]
+		if _, ok := ecs.Entities[i].(*Enemy); !ok || !ecs.Alive(i) || !v.sees(p) {
+			continue
+		}
+		hostiles = append(hostiles, p)
+	}
+	return
+}
+
+// Named ... positions of living entities named name which the caster can see
+func (v CasterView) Named(name string) (points []gruid.Point) {
+	ecs := v.g.ECS
+	for _, i := range Query(ecs.Name, ecs.Positions) {
+		p := ecs.Positions[i]
+		if i == v.caster || ecs.Name[i] != name || !ecs.Alive(i) || !v.sees(p) {
+			continue
+		}
+		points = append(points, p)
+	}
+	return
+}
+
+// Knows ... the caster learned word. enemies cast by nature and know every word
+func (v CasterView) Knows(word string) bool {
+	vocabulary, ok := v.g.ECS.Vocabularies[v.caster]
+	return !ok || vocabulary.Knows(word)
+}
+
+// sees ... the caster can see p. game has only fov of the player, so enemy sees what is in fov when it is in fov
+func (v CasterView) sees(p gruid.Point) bool {
+	if v.caster == v.g.ECS.PlayerID {
+		return v.g.InFOV(p)
+	}
+	return v.g.InFOV(v.CasterPosition()) && v.g.InFOV(p)
+}
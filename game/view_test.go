@@ -0,0 +1,110 @@
+package game
+
+import (
+	"testing"
+
+	"compiler"
+	"domain"
+
+	"github.com/anaseto/gruid"
+)
+
+// newViewGame ... game on open floor which has the player at (10, 10) and enemies at enemies
+func newViewGame(enemies ...gruid.Point) (g *Game, ids []int) {
+	g = NewGame(1)
+	for _, i := range g.ECS.Entities.IDs() {
+		if i != g.ECS.PlayerID {
+			g.ECS.RemoveEntity(i)
+		}
+	}
+	g.Map.Grid.Fill(domain.Floor)
+	g.ECS.MovePlayer(gruid.Point{X: 10, Y: 10})
+	for _, word := range compiler.LearnableWords() {
+		g.ECS.Vocabularies[g.ECS.PlayerID].Learn(word)
+	}
+	for _, p := range enemies {
+		id := g.ECS.AddEntity(&Enemy{}, p)
+		g.ECS.Statuses[id] = &Status{HP: 10, MaxHP: 10}
+		ids = append(ids, id)
+	}
+	g.UpdateFOV()
+	return
+}
+
+// compileTarget ... target of the first magic which spell of caster compiles to
+func compileTarget(t *testing.T, g *Game, caster int, spell string) (target gruid.Point) {
+	magics, err := compiler.CompileWith(spell, g.ViewFrom(caster))
+	if err != nil {
+		t.Fatal(spell, err)
+	}
+	if magics[0].Actor != caster {
+		t.Fatalf("%s: expect actor %d but got %d", spell, caster, magics[0].Actor)
+	}
+	target = magics[0].Target
+	return
+}
+
+func TestCompileWithView(t *testing.T) {
+	g, ids := newViewGame(gruid.Point{X: 13, Y: 10}, gruid.Point{X: 10, Y: 8})
+	pid := g.ECS.PlayerID
+
+	if target := compileTarget(t, g, pid, "(gandr (nearest-enemy))"); target != (gruid.Point{X: 0, Y: -2}) {
+		t.Fatalf("expect nearest enemy at (0, -2) but got %v", target)
+	}
+	if target := compileTarget(t, g, pid, "(gandr (enemy-count-in 2) (enemy-count-in 3))"); target != (gruid.Point{X: 1, Y: 2}) {
+		t.Fatalf("expect enemy counts (1, 2) but got %v", target)
+	}
+
+	// the spell hits the nearest enemy when it is cast
+	magics, err := compiler.CompileWith("(gandr (nearest-enemy))", g.ViewFrom(pid))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.CastMagic(magics); err != nil {
+		t.Fatal(err)
+	}
+	if g.ECS.Statuses[ids[1]].HP >= 10 || g.ECS.Statuses[ids[0]].HP != 10 {
+		t.Fatal("expect only the nearest enemy is hit")
+	}
+
+	// enemy sees the player
+	if target := compileTarget(t, g, ids[0], "(gandr (nearest-enemy))"); target != (gruid.Point{X: -3, Y: 0}) {
+		t.Fatalf("expect player at (-3, 0) from enemy but got %v", target)
+	}
+	if target := compileTarget(t, g, ids[0], "(gandr (player-x) (player-y))"); target != (gruid.Point{X: -3, Y: 0}) {
+		t.Fatalf("expect player at (-3, 0) from enemy but got %v", target)
+	}
+
+	// target by name
+	g.ECS.Name[ids[0]] = "troll"
+	if target := compileTarget(t, g, pid, `(gandr "troll")`); target != (gruid.Point{X: 3, Y: 0}) {
+		t.Fatalf("expect troll at (3, 0) but got %v", target)
+	}
+	if _, err := compiler.CompileWith(`(gandr "orc")`, g.ViewFrom(pid)); err == nil {
+		t.Fatal("expect error when no entity has the name")
+	}
+}
+
+func TestCompileWithViewNoEnemy(t *testing.T) {
+	g, _ := newViewGame()
+	if _, err := compiler.CompileWith("(gandr (nearest-enemy))", g.ViewFrom(g.ECS.PlayerID)); err == nil {
+		t.Fatal("expect error when no enemy is in sight")
+	}
+}
+
+func TestPredictSpell(t *testing.T) {
+	g, _ := newViewGame()
+	magics, cost, targets, area, err := g.PredictSpell("(gandr 1 0)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(magics) != 1 || cost != magics[0].Amount || len(targets) != 1 || targets[0] != (gruid.Point{X: 11, Y: 10}) || !area[targets[0]] {
+		t.Fatalf("expect gandr at (11, 10) but got targets %v and area %v", targets, area)
+	}
+	// a preview of a huge target ends with error instead of walking its line
+	for _, spell := range []string{"(gandr 50000000 0)", "(cone (gandr 9223372036854775807 1))", "(let ((x 50000000)) (line (gandr x x)))"} {
+		if _, _, _, area, err := g.PredictSpell(spell); err == nil || len(area) != 0 {
+			t.Fatalf("%s: expect error of target out of sight", spell)
+		}
+	}
+}
@@ -1,17 +1,28 @@
 package main
 import (
+	"flag"
 	"log"
 	"context"
+	"os"
 
 	"domain"
+	"spell"
 
 	"github.com/anaseto/gruid"
 	sdl "github.com/anaseto/gruid-sdl"
 )
 
 func main() {
+	// rt spell runs headless spell REPL instead of game
+	if len(os.Args) > 1 && os.Args[1] == "spell" {
+		os.Exit(spell.Command(os.Args[2:], os.Stdin, os.Stdout, os.Stderr))
+	}
+
+	seed := flag.Int64("seed", 0, "seed of new game to replay it. 0 makes a new seed")
+	flag.Parse()
+
 	gd := gruid.NewGrid(domain.UIWidth, domain.UIHight)
-	m := &Model{ Grid: gd}
+	m := &Model{ Grid: gd, Seed: *seed}
 	// Specify a driver among the provided ones.
 	tile, err := GetTileDrawer()
 	if err != nil {
@@ -1,8 +1,9 @@
 package main
 
 import (
+	"errors"
+	"fmt"
 	"log"
-	"math/rand"
 	"sort"
 	"strings"
 	"time"
@@ -32,6 +33,8 @@ const (
 	ActionInput       ActionType = "action input"
 	ActionExamine     ActionType = "action examine a map"
 	ActionCastMagic   ActionType = "action cast magic"
+	ActionDescend     ActionType = "action descend"
+	ActionAscend      ActionType = "action ascend"
 )
 
 type UIMode int
@@ -47,6 +50,7 @@ const (
 	modeInput
 	modeCastMagic
 	modeExamination // map examination mode
+	modeSpellBook   // menu of spell book opened in modeCastMagic
 )
 
 type MenuEntry int
@@ -73,7 +77,23 @@ type Model struct {
 	InputLabel    *ui.Label
 	Viewer        *ui.Pager
 	Input         string
-	Target        Targetting // for Item of targetting
+	InputError    compiler.Positioned // error of spell in Input to point out in input box
+	WarnedInput   string              // spell whose warnings are shown. casting it again ignores them
+	SpellBook     *compiler.SpellBook
+	SpellBookMenu *ui.Menu
+	Target        Targetting   // for Item of targetting
+	Preview       SpellPreview // spell in Input checked on each keystroke
+	Seed          int64        // seed of new game. 0 makes a seed from time
+}
+
+// SpellPreview ... result of checking spell in input before it is cast
+type SpellPreview struct {
+	Err     error                // why the spell is invalid. nil if it is valid
+	Define  string               // name of spell if input defines it
+	Magics  []domain.Magic       // magics which the spell makes now
+	Cost    int                  // mana which the magics consume
+	Targets []gruid.Point        // map positions which the magics target
+	Area    map[gruid.Point]bool // map positions which the magics affect
 }
 
 type Targetting struct {
@@ -96,6 +116,7 @@ func (m *Model) init() (eff gruid.Effect) {
 	m.DescLabel = &ui.Label{Box: &ui.Box{}}
 	m.InitializeMessageViewer()
 	m.Mode = modeMenu
+	m.loadSpellBook()
 
 	menuEntries := []ui.MenuEntry{
 		MenuNewGame:  {Text: ui.Text("(N)ew game"), Keys: []gruid.Key{"N", "n"}},
@@ -141,6 +162,9 @@ func (m *Model) Update(msg gruid.Msg) (eff gruid.Effect) {
 		return m.updateInput(msg)
 	case modeCastMagic:
 		return m.updateCastMagic(msg)
+	case modeSpellBook:
+		m.updateSpellBook(msg)
+		return nil
 	case modeInventoryDrop, modeInventoryActivate:
 		m.updateInventory(msg)
 		return nil
@@ -192,6 +216,10 @@ func (m *Model) updateMsgKeyDown(msg gruid.MsgKeyDown) {
 		m.Action = UIAction{Type: ActionInput}
 	case "M":
 		m.Action = UIAction{Type: ActionCastMagic}
+	case ">":
+		m.Action = UIAction{Type: ActionDescend}
+	case "<":
+		m.Action = UIAction{Type: ActionAscend}
 	}
 
 }
@@ -289,26 +317,181 @@ func (m *Model) updateCastMagic(msg gruid.Msg) (eff gruid.Effect) {
 		case gruid.KeyEscape:
 			m.Mode = modeNormal
 			return
+		case gruid.KeyTab:
+			m.OpenSpellBook()
+			return
 		case gruid.KeyEnter:
-			magic, err := compiler.Compile(m.Input)
+			m.InputError = nil
+			if m.defineSpell() {
+				m.updatePreview()
+				return
+			}
+			magics, err := compiler.CompileWith(m.Input, m.Game.ViewFrom(m.Game.ECS.PlayerID))
 			if err != nil {
-				m.Game.Logf("%v", domain.ColorStatusWounded, err)
+				// keep input to fix the spell at the error
+				if errors.As(err, &m.InputError) {
+					m.Game.Logf("%v", domain.ColorStatusWounded, err)
+					return
+				}
+				m.Game.Logf("%s: %v", domain.ColorStatusWounded, m.spellSource(), err)
 				m.Input = ""
+				m.updatePreview()
 				return
 			}
-			magic.Actor = m.Game.ECS.PlayerID
-			m.Game.CastMagic(magic)
-			m.Game.EndTurn()
-			m.Mode = modeNormal
+			if m.warnSpell(m.Input, magics) {
+				return
+			}
+			m.castMagics(magics, m.spellSource())
 			return
 		default:
 			eff = m.updateInput(msg)
+			m.updatePreview()
 			return
 		}
 	}
 	return
 }
 
+// updatePreview ... lex, parse and compile spell in input to show whether it is valid,
+// how much mana it costs and where it hits before enter is pressed
+func (m *Model) updatePreview() {
+	m.Preview = SpellPreview{}
+	m.InputError = nil
+	if strings.TrimSpace(m.Input) == "" {
+		return
+	}
+	// define is checked with a scratch book so that the spell book is kept as it is
+	spell, define, err := (&compiler.SpellBook{}).Define(m.Input)
+	switch {
+	case define && err == nil:
+		m.Preview.Define = spell.Name
+		// the spell is already built, so its cost is computed without error
+		m.Preview.Cost, _ = compiler.Cost(spell.Source)
+		return
+	case err == nil:
+		p := &m.Preview
+		p.Magics, p.Cost, p.Targets, p.Area, err = m.Game.PredictSpell(m.Input)
+	}
+	if err != nil {
+		m.Preview = SpellPreview{Err: err}
+		errors.As(err, &m.InputError)
+	}
+}
+
+// previewStatus ... one line status of spell in input shown in input box
+func (m *Model) previewStatus() (status string, color gruid.Color) {
+	p := m.Preview
+	color = domain.ColorStatusHealthy
+	switch {
+	case strings.TrimSpace(m.Input) == "":
+		status = "empty"
+	case p.Err != nil:
+		status = "invalid: " + p.Err.Error()
+		color = domain.ColorStatusWounded
+	case p.Define != "":
+		status = fmt.Sprintf("valid: define %s cost %d MP", p.Define, p.Cost)
+	case len(p.Magics) == 0:
+		status = "valid: no magic"
+	default:
+		status = fmt.Sprintf("valid: cost %d MP", p.Cost)
+		if len(p.Magics) == 1 {
+			t := p.Magics[0].Target
+			status += fmt.Sprintf(" target (%d, %d)", t.X, t.Y)
+		} else {
+			status += fmt.Sprintf(" %d magics", len(p.Magics))
+		}
+		if p.Cost > m.Game.ECS.Statuses[m.Game.ECS.PlayerID].Mana {
+			status += " (not enough mana)"
+			color = domain.ColorStatusWounded
+		}
+	}
+	return
+}
+
+// warnSpell ... log warnings of spell source and its magics which backfire at walls before the turn is spent.
+// returns true if they are shown. pressing enter again on the same spell casts it
+func (m *Model) warnSpell(source string, magics []domain.Magic) (warned bool) {
+	warnings, _ := compiler.Check(source)
+	backfires := m.Game.Backfires(magics)
+	if len(warnings)+len(backfires) == 0 || m.WarnedInput == source {
+		return
+	}
+	for _, w := range warnings {
+		m.Game.Logf("%v", domain.ColorStatusWounded, w)
+	}
+	for _, magic := range backfires {
+		m.Game.Logf("warning: %s stops at a wall and hits you", domain.ColorStatusWounded, magic.Name)
+	}
+	m.Game.Logf("Press enter again to cast it anyway", domain.ColorLogSpecial)
+	// position of warning is shown only for spell in input
+	if len(warnings) > 0 && source == m.Input {
+		m.InputError = warnings[0]
+	}
+	m.WarnedInput = source
+	warned = true
+	return
+}
+
+// castMagics ... player casts magics made from source. turn ends if they are cast
+func (m *Model) castMagics(magics []domain.Magic, source string) {
+	m.WarnedInput = ""
+	m.Game.Logf("You chant %s", domain.ColorLogSpecial, source)
+	if err := m.Game.CastMagic(magics); err == nil {
+		m.Game.EndTurn()
+	}
+	m.Mode = modeNormal
+}
+
+// defineSpell ... save spell to spell book if input is (define name spell). returns false if input is not define
+func (m *Model) defineSpell() (ok bool) {
+	spell, ok, err := m.SpellBook.Define(m.Input)
+	if !ok {
+		return
+	}
+	if err != nil {
+		m.Game.Logf("%v", domain.ColorStatusWounded, err)
+		// keep input to fix the spell at the error
+		if !errors.As(err, &m.InputError) {
+			m.Input = ""
+		}
+		return
+	}
+	m.Game.Logf("You write %s in spell book: %s", domain.ColorLogSpecial, spell.Name, spell.Source)
+	m.Input = ""
+	m.saveSpellBook()
+	return
+}
+
+// updateSpellBook ... cast the spell selected from spell book. it is warned in the same way as spell in input
+func (m *Model) updateSpellBook(msg gruid.Msg) {
+	m.SpellBookMenu.Update(msg)
+	switch m.SpellBookMenu.Action() {
+	case ui.MenuQuit:
+		m.Mode = modeCastMagic
+	case ui.MenuInvoke:
+		spell := m.SpellBook.Spells[m.SpellBookMenu.Active()]
+		magics, err := spell.Cast(m.Game.ViewFrom(m.Game.ECS.PlayerID))
+		if err != nil {
+			m.Game.Logf("%s: %v", domain.ColorStatusWounded, spell.Name, err)
+			m.Mode = modeNormal
+			return
+		}
+		if m.warnSpell(spell.Source, magics) {
+			return
+		}
+		m.castMagics(magics, spell.Name)
+	}
+}
+
+// spellSource ... normalized source of spell in input. input is returned as it is if it is broken
+func (m *Model) spellSource() (source string) {
+	source, err := compiler.FormatSource(m.Input)
+	if err != nil {
+		source = m.Input
+	}
+	return
+}
+
 func (m *Model) updateInput(msg gruid.Msg) (eff gruid.Effect) {
 	switch e := msg.(type) {
 	case gruid.MsgKeyDown:
@@ -337,7 +520,12 @@ func (m *Model) updateMenu(msg gruid.Msg) (eff gruid.Effect) {
 		m.MenuInfoLabel.SetText("")
 		switch m.GameMenu.Active() {
 		case int(MenuNewGame):
-			m.Game = game.NewGame()
+			seed := m.Seed
+			if seed == 0 {
+				seed = time.Now().UnixNano()
+			}
+			m.Game = game.NewGame(seed)
+			m.Game.Logf("seed of this game: %d", domain.ColorLogSpecial, seed)
 			m.Mode = modeNormal
 		case int(MenuContinue):
 			m.loadGame()
@@ -399,14 +587,23 @@ func (m *Model) handleAction() (eff gruid.Effect) {
 		return
 	case ActionCastMagic:
 		m.Mode = modeCastMagic
+		m.updatePreview()
 		return
+	case ActionDescend:
+		if err := m.Game.Descend(); err != nil {
+			m.Game.Logf("Could not descend: %v", domain.ColorStatusWounded, err)
+		}
+	case ActionAscend:
+		if err := m.Game.Ascend(); err != nil {
+			m.Game.Logf("Could not ascend: %v", domain.ColorStatusWounded, err)
+		}
 	}
 	if m.Game.ECS.PlayerDead() {
 		m.Game.Logf("You Died -- press Escape to quit", domain.ColorLogSpecial)
 		m.Mode = modeEnd
 		return nil
 	}
-	if m.Game.ECS.GameClear() {
+	if m.Game.GameClear() {
 		m.Game.Logf("You cleared the game!", domain.ColorLogSpecial)
 		m.Mode = modeEnd
 		return nil
@@ -435,10 +632,14 @@ func (m *Model) Draw() (grid gruid.Grid) {
 		mapGrid.Copy(m.Inventory.Draw())
 		grid = m.Grid
 		return
-	case modeInput, modeCastMagic:
+	case modeInput:
 		mapGrid.Copy(m.DrawInputBox())
 		grid = m.Grid
 		return
+	case modeSpellBook:
+		mapGrid.Copy(m.SpellBookMenu.Draw())
+		grid = m.Grid
+		return
 	}
 
 	// init grid
@@ -458,12 +659,22 @@ func (m *Model) Draw() (grid gruid.Grid) {
 		mapGrid.Set(it.P(), c)
 	}
 
-	// sort entity by RenderOrder
-	sortedEntities := make([]int, 0, len(g.ECS.Entities))
-	for i := range g.ECS.Entities {
-		sortedEntities = append(sortedEntities, i)
+	// draw area of pending magics with turns until they take effect
+	for p, turns := range g.PendingArea() {
+		if !g.Map.Explored[p] {
+			continue
+		}
+		c := mapGrid.At(p)
+		c.Style.Bg = domain.ColorPendingMagic
+		if turns < 10 {
+			c.Rune = rune('0' + turns)
+		}
+		mapGrid.Set(p, c)
 	}
-	sort.Slice(sortedEntities, func(i, j int) bool {
+
+	// sort entity by RenderOrder
+	sortedEntities := game.Query(g.ECS.Entities, g.ECS.Positions)
+	sort.SliceStable(sortedEntities, func(i, j int) bool {
 		return g.ECS.GetRenderOrder(sortedEntities[i]) < g.ECS.GetRenderOrder(sortedEntities[j])
 	})
 
@@ -482,9 +693,12 @@ func (m *Model) Draw() (grid gruid.Grid) {
 	// for examine mode
 	if m.Mode == modeExamination || m.Mode == modeTargetting {
 		p := m.convertUiPositionToMapPosition(m.Target.Position)
-		c := mapGrid.At(p)
-		c.Rune = '+'
-		mapGrid.Set(p, c)
+		m.DrawTargets(mapGrid, []gruid.Point{p}, nil)
+	}
+	// predicted target and area of spell being typed
+	if m.Mode == modeCastMagic {
+		m.DrawTargets(mapGrid, m.Preview.Targets, m.Preview.Area)
+		mapGrid.Copy(m.DrawInputBox())
 	}
 
 	// draw ui's
@@ -494,6 +708,20 @@ func (m *Model) Draw() (grid gruid.Grid) {
 	return
 }
 
+// DrawTargets ... mark targets with + over the cells of area
+func (m *Model) DrawTargets(gd gruid.Grid, targets []gruid.Point, area map[gruid.Point]bool) {
+	for p := range area {
+		c := gd.At(p)
+		c.Style.Bg = domain.ColorTargetArea
+		gd.Set(p, c)
+	}
+	for _, p := range targets {
+		c := gd.At(p)
+		c.Rune = '+'
+		gd.Set(p, c)
+	}
+}
+
 func (m *Model) DrawLog(gd gruid.Grid) {
 	j := 1
 
@@ -518,7 +746,7 @@ func (m *Model) DrawStatus(gd gruid.Grid) {
 	if statusPlayer.HP < statusPlayer.MaxHP/2 {
 		st.Fg = domain.ColorStatusWounded
 	}
-	m.StatusLabel.Content = ui.Textf("HP: %d/%d  Killed Enemy:%d/%d", statusPlayer.HP, statusPlayer.MaxHP, g.ECS.Bodies, domain.EnemyNumber)
+	m.StatusLabel.Content = ui.Textf("HP: %d/%d  MP: %d/%d  Depth:%d/%d  Killed Enemy:%d/%d", statusPlayer.HP, statusPlayer.MaxHP, statusPlayer.Mana, statusPlayer.MaxMana, g.Depth, domain.MaxDepth, g.ECS.Bodies, len(g.ECS.AI))
 	m.StatusLabel.Box = &ui.Box{Title: ui.Text("Status")}
 	m.StatusLabel.Draw(gd)
 }
@@ -529,11 +757,11 @@ func (m *Model) DrawNames(gd gruid.Grid) {
 		return
 	}
 	p := m.Target.Position.Sub(maprg.Min)
+	if !m.Game.InFOV(p) {
+		return
+	}
 	names := []string{}
-	for i, q := range m.Game.ECS.Positions {
-		if q != p || !m.Game.InFOV(q) {
-			continue
-		}
+	for _, i := range m.Game.ECS.At(p) {
 		name := m.Game.ECS.GetName(i)
 		if name != "" {
 			names = append(names, name)
@@ -572,13 +800,42 @@ func (m *Model) DrawMenu() (grid gruid.Grid) {
 }
 
 func (m *Model) DrawInputBox() (grid gruid.Grid) {
-	mapGrid := m.Grid.Slice(m.getMapRange().Lines(0, 3))
+	lines := 3
+	text := m.Input + "<"
+	marker := ""
+	if m.InputError != nil {
+		// underline the word which caused the error on the next line of input
+		lines++
+		marker = strings.Repeat(" ", m.InputError.Position().Column) + strings.Repeat("^", m.InputError.Width())
+		text += "\n" + marker
+	}
+	status, statusColor := "", gruid.Color(0)
+	if m.Mode == modeCastMagic {
+		lines++
+		status, statusColor = m.previewStatus()
+		text += "\n" + status
+	}
+	mapGrid := m.Grid.Slice(m.getMapRange().Lines(0, lines))
 	mapGrid.Fill(gruid.Cell{Rune: ' '})
+	title := "Input"
+	if m.Mode == modeCastMagic {
+		title = "Spell (Tab: spell book)"
+	}
 	m.InputLabel = &ui.Label{
-		Box:     &ui.Box{Title: ui.Text("Input")},
-		Content: ui.Text(m.Input + "<"),
+		Box:     &ui.Box{Title: ui.Text(title)},
+		Content: ui.Text(text),
 	}
 	grid = m.InputLabel.Draw(mapGrid)
+	if m.InputError != nil {
+		st := gruid.Style{}
+		st.Fg = domain.ColorStatusWounded
+		ui.NewStyledText(marker, st).Draw(grid.Slice(grid.Range().Line(2).Shift(1, 0, -1, 0)))
+	}
+	if status != "" {
+		st := gruid.Style{}
+		st.Fg = statusColor
+		ui.NewStyledText(status, st).Draw(grid.Slice(grid.Range().Line(lines-2).Shift(1, 0, -1, 0)))
+	}
 	return
 }
 
@@ -586,10 +843,7 @@ func (m *Model) PickUpItem() {
 	g := m.Game
 	pp := g.ECS.PlayerPosition()
 	// search item at pp
-	for i, p := range g.ECS.Positions {
-		if p != pp {
-			continue
-		}
+	for _, i := range g.ECS.At(pp) {
 		err := g.InventoryAdd(g.ECS.PlayerID, i)
 		if err != nil {
 			if err.Error() == domain.ErrNoShow {
@@ -624,6 +878,35 @@ func (m *Model) OpenInventory(title string) {
 	})
 }
 
+// OpenSpellBook ... open menu of spells in spell book
+func (m *Model) OpenSpellBook() {
+	if len(m.SpellBook.Spells) == 0 {
+		m.Game.Logf("spell book is empty. write a spell by (define name spell)", domain.ColorLogSpecial)
+		return
+	}
+	entries := []ui.MenuEntry{}
+	r := 'a'
+	for _, spell := range m.SpellBook.Spells {
+		text := string(r) + " - " + spell.Name + ": " + spell.Source
+		if cost, err := compiler.Cost(spell.Source); spell.Err() == nil && err == nil {
+			text += fmt.Sprintf(" (%d MP)", cost)
+		} else {
+			text += " (broken)"
+		}
+		entries = append(entries, ui.MenuEntry{
+			Text: ui.Text(text),
+			Keys: []gruid.Key{gruid.Key(r)},
+		})
+		r++
+	}
+	m.SpellBookMenu = ui.NewMenu(ui.MenuConfig{
+		Grid:    gruid.NewGrid(domain.UIWidth, domain.MapHight),
+		Box:     &ui.Box{Title: ui.Text("Spell Book")},
+		Entries: entries,
+	})
+	m.Mode = modeSpellBook
+}
+
 func (m *Model) getMapRange() gruid.Range {
 	return gruid.NewRange(0, domain.LogLines, domain.UIWidth, domain.UIHight-domain.StatusLines)
 }
@@ -661,6 +944,7 @@ func (m *Model) saveGame() {
 		log.Fatal(err)
 		return
 	}
+	m.saveSpellBook()
 	m.Game.Logf("game saved successfully!", domain.ColorLogSpecial)
 }
 
@@ -677,8 +961,33 @@ func (m *Model) loadGame() {
 		return
 	}
 	m.Game = g
-	m.Game.Map.SetRand(rand.New(rand.NewSource(time.Now().UnixNano())))
 	m.Mode = modeNormal
 
 	m.Game.Logf("load game successfully!", domain.ColorLogSpecial)
 }
+
+// saveSpellBook ... save spell book apart from game so that it is kept over games
+func (m *Model) saveSpellBook() {
+	data, err := save.EncodeSpellBook(m.SpellBook)
+	if err == nil {
+		err = save.SaveFile(save.SpellBookFile, data)
+	}
+	if err != nil {
+		m.Game.Logf("could not save spell book: %v", domain.ColorStatusWounded, err)
+	}
+}
+
+// loadSpellBook ... load spell book. book is empty if it is not saved yet
+func (m *Model) loadSpellBook() {
+	m.SpellBook = &compiler.SpellBook{}
+	data, err := save.LoadFile(save.SpellBookFile)
+	if err != nil {
+		return
+	}
+	book, err := save.DecodeSpellBook(data)
+	if err != nil {
+		m.MenuInfoLabel.SetText("could not load spell book: " + err.Error())
+		return
+	}
+	m.SpellBook = book
+}
@@ -51,6 +51,10 @@ func (t *TileDrawer) GetImage(c gruid.Cell) image.Image {
 	switch c.Style.Bg {
 	case domain.ColorFOV:
 		bg = image.NewUniform(color.RGBA{0x18, 0x49, 0x56, 255})
+	case domain.ColorPendingMagic:
+		bg = image.NewUniform(color.RGBA{0x5a, 0x2a, 0x4a, 255})
+	case domain.ColorTargetArea:
+		bg = image.NewUniform(color.RGBA{0x3a, 0x5a, 0x2a, 255})
 	}
 	switch c.Style.Fg {
 	case domain.ColorPlayer:
@@ -23,6 +23,7 @@ func RegisterEntity() {
 	gob.Register(&game.HealthPotion{})
 	gob.Register(&game.MagicArrowScroll{})
 	gob.Register(&game.ExplodeScroll{})
+	gob.Register(&game.KeywordScroll{})
 }
 
 func Encode(g *game.Game) (encodedData []byte, err error) {
@@ -34,16 +35,15 @@ func Encode(g *game.Game) (encodedData []byte, err error) {
 	}
 	var buf bytes.Buffer
 	writeGzip := gzip.NewWriter(&buf)
-	defer func() {
-		err := writeGzip.Close()
-		if err != nil {
-			fmt.Printf("failed to close a gzip writer: %v", err)
-		}
-	}()
 
 	if _, err = writeGzip.Write(data.Bytes()); err != nil {
 		return
 	}
+	// gzip footer is written on close. close it before reading buf
+	if err = writeGzip.Close(); err != nil {
+		err = fmt.Errorf("failed to close a gzip writer: %w", err)
+		return
+	}
 	encodedData = buf.Bytes()
 	return
 }
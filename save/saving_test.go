@@ -3,10 +3,15 @@ package save
 import (
 	"bytes"
 	"encoding/gob"
+	"reflect"
 
+	"compiler"
+	"domain"
 	"game"
 
 	"testing"
+
+	"github.com/anaseto/gruid"
 )
 
 func TestSaveLoad(t *testing.T){
@@ -14,7 +19,7 @@ func TestSaveLoad(t *testing.T){
 
 
 
-	g := game.NewGame()
+	g := game.NewGame(1)
 
 	println("Log")
 
@@ -90,4 +95,228 @@ func TestSaveLoad(t *testing.T){
 	if err != nil {
 		t.Fatal(err)
 	}
-}
\ No newline at end of file
+}
+
+func TestSaveMana(t *testing.T) {
+	g := game.NewGame(1)
+	st := g.ECS.Statuses[g.ECS.PlayerID]
+	st.Mana = 7
+
+	data, err := Encode(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g2, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st2 := g2.ECS.Statuses[g2.ECS.PlayerID]
+	if st2.Mana != st.Mana || st2.MaxMana != st.MaxMana || st2.ManaRegen != st.ManaRegen {
+		t.Fatalf("expect mana %d/%d (+%d) but got %d/%d (+%d)", st.Mana, st.MaxMana, st.ManaRegen, st2.Mana, st2.MaxMana, st2.ManaRegen)
+	}
+}
+
+func TestSavePendingMagic(t *testing.T) {
+	g := game.NewGame(1)
+	for _, word := range []string{"delay", "persist", "fire"} {
+		g.ECS.Vocabularies[g.ECS.PlayerID].Learn(word)
+	}
+	magics, err := compiler.CompileWith("(delay 3 (persist 2 (fire (gandr 0 0))))", g.ViewFrom(g.ECS.PlayerID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = g.CastMagic(magics); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := Encode(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g2, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(g.Pending, g2.Pending) {
+		t.Fatalf("expect pending magics %v but got %v", g.Pending, g2.Pending)
+	}
+}
+
+func TestSaveVocabulary(t *testing.T) {
+	g := game.NewGame(1)
+	g.ECS.Vocabularies[g.ECS.PlayerID].Learn("fire")
+
+	data, err := Encode(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g2, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(g.ECS.Vocabularies, g2.ECS.Vocabularies) {
+		t.Fatalf("expect vocabularies %v but got %v", g.ECS.Vocabularies, g2.ECS.Vocabularies)
+	}
+	if _, err = compiler.CompileWith("(fire (gandr 0 0))", g2.ViewFrom(g2.ECS.PlayerID)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadAndContinue(t *testing.T) {
+	g := game.NewGame(7)
+	g.EndTurn()
+	data, err := Encode(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g2, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g2.Seed != 7 || g2.RNG.State != g.RNG.State {
+		t.Fatalf("expect seed 7 and rng state %d but got %d and %d", g.RNG.State, g2.Seed, g2.RNG.State)
+	}
+
+	// loaded game draws the same random numbers as the game which keeps going
+	for i := 0; i < 20; i++ {
+		g.EndTurn()
+		g2.EndTurn()
+	}
+	if !reflect.DeepEqual(g.ECS.Positions, g2.ECS.Positions) || g.RNG.State != g2.RNG.State {
+		t.Fatal("expect loaded game continues the same as the saved one")
+	}
+}
+
+func TestSaveLevels(t *testing.T) {
+	g := game.NewGame(1)
+	g.ECS.Statuses[g.ECS.PlayerID].HP = 1000
+	p, _ := g.Map.Stairs(domain.StairsDown)
+	g.ECS.MovePlayer(p)
+	if err := g.Descend(); err != nil {
+		t.Fatal(err)
+	}
+	data, err := Encode(g)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g2, err := Decode(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g2.Depth != 2 || g2.Levels[1] == nil || !reflect.DeepEqual(g.Levels[1].Map.Grid, g2.Levels[1].Map.Grid) {
+		t.Fatal("expect depth and the left level are saved")
+	}
+	if !reflect.DeepEqual(g.Levels[1].ECS.Positions, g2.Levels[1].ECS.Positions) {
+		t.Fatal("expect entities of the left level are saved")
+	}
+
+	// loaded game goes back up to the saved level
+	p, _ = g2.Map.Stairs(domain.StairsUp)
+	g2.ECS.MovePlayer(p)
+	if err := g2.Ascend(); err != nil {
+		t.Fatal(err)
+	}
+	if g2.Depth != 1 || g2.Map.Grid.At(g2.ECS.PlayerPosition()) != domain.StairsDown {
+		t.Fatal("expect player is on stairs down of the saved level")
+	}
+}
+
+// oldECS ... layout of game.ECS saved before components had stores
+type oldECS struct {
+	Entities    map[int]game.Entity
+	Positions   map[int]gruid.Point
+	PlayerID    int
+	NextID      int
+	Statuses    map[int]*game.Status
+	AI          map[int]*game.EnemyAI
+	Name        map[int]string
+	Styles      map[int]game.Style
+	Inventories map[int]*game.Inventory
+}
+
+type oldGame struct {
+	ECS  *oldECS
+	Map  *game.GameMap
+	Logs []game.LogEntry
+}
+
+func TestLoadOldECS(t *testing.T) {
+	g := game.NewGame(1)
+	old := oldGame{
+		ECS: &oldECS{
+			Entities:    g.ECS.Entities,
+			Positions:   g.ECS.Positions,
+			PlayerID:    g.ECS.PlayerID,
+			NextID:      g.ECS.NextID,
+			Statuses:    g.ECS.Statuses,
+			AI:          g.ECS.AI,
+			Name:        g.ECS.Name,
+			Styles:      g.ECS.Styles,
+			Inventories: g.ECS.Inventories,
+		},
+		Map: g.Map,
+	}
+	buf := &bytes.Buffer{}
+	if err := gob.NewEncoder(buf).Encode(old); err != nil {
+		t.Fatal(err)
+	}
+	g2, err := DecodeNoGzip(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(g.ECS.Positions, g2.ECS.Positions) {
+		t.Fatalf("expect positions %v but got %v", g.ECS.Positions, g2.ECS.Positions)
+	}
+	// spatial index is built from loaded positions
+	found := false
+	for _, id := range g2.ECS.At(g2.ECS.PlayerPosition()) {
+		found = found || id == g2.ECS.PlayerID
+	}
+	if !found {
+		t.Fatal("expect player is found at player position")
+	}
+}
+
+func TestSaveSpellBook(t *testing.T) {
+	book := &compiler.SpellBook{}
+	if _, _, err := book.Define("(define fireball (seiethr 2 0))"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := book.Define("(define bolt (gandr 1 0))"); err != nil {
+		t.Fatal(err)
+	}
+	// spell saved by older compiler. it is kept but can not be cast
+	book.Spells = append(book.Spells, &compiler.Spell{Name: "old", Source: "(oldmagic 1 2)"})
+
+	data, err := EncodeSpellBook(book)
+	if err != nil {
+		t.Fatal(err)
+	}
+	book2, err := DecodeSpellBook(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(book2.Spells) != 3 {
+		t.Fatalf("expect 3 spells but got %d", len(book2.Spells))
+	}
+
+	fireball, ok := book2.Lookup("fireball")
+	if !ok {
+		t.Fatal("fireball is lost")
+	}
+	magics, err := fireball.Cast(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(magics) != 1 || magics[0].Name != "seiethr" || magics[0].Target != (gruid.Point{X: 2, Y: 0}) {
+		t.Fatalf("unexpected magics of recompiled spell: %v", magics)
+	}
+
+	old, _ := book2.Lookup("old")
+	if old.Err() == nil {
+		t.Fatal("expect error of broken spell")
+	}
+	if _, err := old.Cast(nil); err == nil {
+		t.Fatal("broken spell is cast")
+	}
+}
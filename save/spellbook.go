@@ -0,0 +1,33 @@
+package save
+
+import (
+	"bytes"
+	"encoding/gob"
+
+	"compiler"
+)
+
+// SpellBookFile ... name of file of spell book in data directory. it is saved apart from game
+const SpellBookFile = "spellbook"
+
+// EncodeSpellBook ... encode names and sources of spells in book
+func EncodeSpellBook(book *compiler.SpellBook) (data []byte, err error) {
+	buf := &bytes.Buffer{}
+	enc := gob.NewEncoder(buf)
+	if err = enc.Encode(book); err != nil {
+		return
+	}
+	data = buf.Bytes()
+	return
+}
+
+// DecodeSpellBook ... decode spell book and compile its spells with current compiler
+func DecodeSpellBook(data []byte) (book *compiler.SpellBook, err error) {
+	book = &compiler.SpellBook{}
+	dec := gob.NewDecoder(bytes.NewReader(data))
+	if err = dec.Decode(book); err != nil {
+		return
+	}
+	book.Recompile()
+	return
+}
@@ -0,0 +1,28 @@
+// spell ... headless spell REPL run by rt spell. it reads a spell per line from stdin and prints its tokens, ast and magics
+package spell
+
+import (
+	"flag"
+	"fmt"
+	"io"
+)
+
+// Command ... run REPL with arguments after rt spell. returns exit status
+func Command(args []string, in io.Reader, out, errOut io.Writer) (status int) {
+	flags := flag.NewFlagSet("spell", flag.ContinueOnError)
+	flags.SetOutput(errOut)
+	asJSON := flags.Bool("json", false, "print each result as a line of json")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "usage: rt spell [-json] < spells\n")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		status = 2
+		return
+	}
+
+	if failed := run(in, out, *asJSON); failed {
+		status = 1
+	}
+	return
+}
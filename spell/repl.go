@@ -0,0 +1,181 @@
+package spell
+
+import (
+	"bufio"
+	"compiler"
+	"domain"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// result ... what the compiler made from a spell. json of it is printed with -json
+type result struct {
+	Source   string         `json:"source"`
+	Format   string         `json:"format,omitempty"`
+	Tokens   []token        `json:"tokens"`
+	AST      *node          `json:"ast,omitempty"`
+	Magics   []domain.Magic `json:"magics,omitempty"`
+	Warnings []string       `json:"warnings,omitempty"`
+	Error    string         `json:"error,omitempty"`
+}
+
+type token struct {
+	Type   string `json:"type"`
+	Label  string `json:"label"`
+	Word   string `json:"word"`
+	Column int    `json:"column"`
+}
+
+type node struct {
+	Type   string `json:"type"`
+	Label  string `json:"label"`
+	Text   string `json:"text,omitempty"`
+	Number int64  `json:"number,omitempty"`
+	Left   *node  `json:"left,omitempty"`
+	Right  *node  `json:"right,omitempty"`
+}
+
+// run ... compile each line of in and print results to out. failed is true if any spell is broken
+func run(in io.Reader, out io.Writer, asJSON bool) (failed bool) {
+	scanner := bufio.NewScanner(in)
+	for scanner.Scan() {
+		source := strings.TrimSpace(scanner.Text())
+		if source == "" {
+			continue
+		}
+		r := evaluate(source)
+		if r.Error != "" {
+			failed = true
+		}
+		if asJSON {
+			printJSON(out, r)
+		} else {
+			printText(out, r)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		fmt.Fprintf(out, "error: %v\n", err)
+		failed = true
+	}
+	return
+}
+
+// evaluate ... run each stage of compiler and keep what it made until a stage fails
+func evaluate(source string) (r result) {
+	r.Source = source
+	tokens, err := compiler.Lex(source)
+	if err != nil {
+		r.Error = err.Error()
+		return
+	}
+	for _, t := range tokens {
+		r.Tokens = append(r.Tokens, token{
+			Type:   t.Type.String(),
+			Label:  t.Label.String(),
+			Word:   t.Word,
+			Column: t.Pos.Column + 1,
+		})
+	}
+
+	ast, err := compiler.Parse(tokens)
+	if err != nil {
+		r.Error = err.Error()
+		return
+	}
+	r.AST = newNode(ast)
+	if r.Format, err = compiler.Format(ast); err != nil {
+		r.Error = err.Error()
+		return
+	}
+
+	warnings, err := compiler.Check(source)
+	if err != nil {
+		r.Error = err.Error()
+		return
+	}
+	for _, w := range warnings {
+		r.Warnings = append(r.Warnings, w.Error())
+	}
+
+	r.Magics, err = compiler.Compile(source)
+	if err != nil {
+		r.Error = err.Error()
+	}
+	return
+}
+
+func newNode(n *domain.Node) (res *node) {
+	if n == nil {
+		return
+	}
+	res = &node{
+		Type:   n.Type.String(),
+		Label:  n.Data.Label.String(),
+		Text:   n.Data.Text,
+		Number: n.Data.Number,
+		Left:   newNode(n.Left),
+		Right:  newNode(n.Right),
+	}
+	return
+}
+
+func printJSON(out io.Writer, r result) {
+	data, err := json.Marshal(r)
+	if err != nil {
+		fmt.Fprintf(out, "error: %v\n", err)
+		return
+	}
+	fmt.Fprintf(out, "%s\n", data)
+}
+
+func printText(out io.Writer, r result) {
+	fmt.Fprintf(out, "spell: %s\n", r.Source)
+	if r.Format != "" {
+		fmt.Fprintf(out, "format: %s\n", r.Format)
+	}
+	if len(r.Tokens) > 0 {
+		fmt.Fprintf(out, "tokens:\n")
+		for _, t := range r.Tokens {
+			fmt.Fprintf(out, "  %3d %-13s %-22s %q\n", t.Column, t.Type, t.Label, t.Word)
+		}
+	}
+	if r.AST != nil {
+		fmt.Fprintf(out, "ast:\n")
+		printNode(out, r.AST, 1)
+	}
+	if len(r.Magics) > 0 {
+		fmt.Fprintf(out, "magics:\n")
+		for _, m := range r.Magics {
+			fmt.Fprintf(out, "  %s target (%d, %d) %s radius %d %s %s %d cost %d\n",
+				m.Name, m.Target.X, m.Target.Y, m.Shape, m.Radius, m.Element, m.Effect, m.Damage, m.Amount)
+		}
+	}
+	for _, w := range r.Warnings {
+		fmt.Fprintf(out, "%s\n", w)
+	}
+	if r.Error != "" {
+		fmt.Fprintf(out, "error: %s\n", r.Error)
+	}
+}
+
+// printNode ... print n and its children indented by depth
+func printNode(out io.Writer, n *node, depth int) {
+	line := n.Type
+	switch {
+	case n.Label == domain.Number.String():
+		line += fmt.Sprintf(" %d", n.Number)
+	case n.Text != "":
+		line += fmt.Sprintf(" %s %s", n.Label, n.Text)
+	case n.Label != domain.Null.String():
+		line += " " + n.Label
+	}
+	fmt.Fprintf(out, "%s%s\n", strings.Repeat("  ", depth), line)
+	if n.Left != nil {
+		printNode(out, n.Left, depth+1)
+	}
+	if n.Right != nil {
+		printNode(out, n.Right, depth+1)
+	}
+}
@@ -0,0 +1,79 @@
+package spell
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRun(t *testing.T) {
+	type TestItem struct {
+		Input string
+		AsJSON bool
+		Failed bool
+		Contains []string
+	}
+	table := map[string]TestItem{
+		"text": {
+			Input: "(gandr 1 2)\n\n(seiethr 0 (-   1))\n",
+			Contains: []string{"format: (seiethr 0 (- 1))", "KeyWordSpell", "Operator OperatorSpell seiethr", "gandr target (1, 2)", "seiethr target (0, -1)"},
+		},
+		"text error": {
+			Input: "(gandr 1 2$)\n",
+			Failed: true,
+			Contains: []string{"error: column 10: expect word but got 2$"},
+		},
+		"text shape": {
+			Input: "(fire (line (gandr 3 0)))\n",
+			Contains: []string{"gandr target (3, 0) line radius 0 fire damage 5"},
+		},
+		"text warning": {
+			Input: "(gandr 0 0)\n",
+			Contains: []string{"column 2: warning: gandr hits the caster", "gandr target (0, 0)"},
+		},
+		"json": {
+			Input: "(gandr 1 2)\n",
+			AsJSON: true,
+			Contains: []string{`"label":"OperatorSpell","text":"gandr"`, `"Target":{"X":1,"Y":2}`},
+		},
+	}
+
+	for key, item := range table {
+		out := &bytes.Buffer{}
+		failed := run(strings.NewReader(item.Input), out, item.AsJSON)
+		assert.Equal(t, item.Failed, failed, key)
+		for _, s := range item.Contains {
+			assert.Contains(t, out.String(), s, key)
+		}
+	}
+}
+
+func TestRunJSONLines(t *testing.T) {
+	out := &bytes.Buffer{}
+	failed := run(strings.NewReader("(gandr 1 2)\n(1 2)\n"), out, true)
+	assert.True(t, failed)
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if !assert.Len(t, lines, 2) {
+		return
+	}
+	r := result{}
+	assert.Nil(t, json.Unmarshal([]byte(lines[1]), &r))
+	assert.Equal(t, "(1 2)", r.Source)
+	assert.Len(t, r.Tokens, 4)
+	assert.Nil(t, r.AST)
+	assert.Equal(t, "column 2: expect operator but got 1", r.Error)
+}
+
+func TestCommand(t *testing.T) {
+	out, errOut := &bytes.Buffer{}, &bytes.Buffer{}
+	assert.Equal(t, 0, Command([]string{"-json"}, strings.NewReader("(gandr 1 2)\n"), out, errOut))
+	assert.Contains(t, out.String(), `"source":"(gandr 1 2)"`)
+
+	assert.Equal(t, 1, Command(nil, strings.NewReader("(1 2)\n"), out, errOut))
+	assert.Equal(t, 2, Command([]string{"-unknown"}, strings.NewReader(""), out, errOut))
+	assert.Contains(t, errOut.String(), "usage: rt spell")
+}